@@ -0,0 +1,23 @@
+; closures share the context they were created in
+(defun adder (n)
+  (fn (x) (+ x n)))
+(def add5 (adder 5))
+(print (add5 10))
+
+(def x 1)
+(def getx (fn () x))
+(def x 2)
+(print (getx))
+
+(defun compose (f g)
+  (fn (x) (f (g x))))
+(print ((compose add5 (adder 100)) 1))
+
+; defs inside a lambda are local to the call
+(defun local (n)
+  (seq
+    (def y (+ n 1))
+    (def z (fn () y))
+    (z)))
+(print (local 41))
+(print x)
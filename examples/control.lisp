@@ -0,0 +1,40 @@
+; multi-way conditionals. the bodies of clauses are in tail position, so
+; loops written with them run in constant space.
+
+(defun classify (n)
+  (cond ((< n 0) "negative")
+        ((= n 0) "zero")
+        ((< n 10) "small")
+        (else "large")))
+
+(print (classify -5))
+(print (classify 0))
+(print (classify 3))
+(print (classify 42))
+
+(defun day-kind (day)
+  (case day
+    (("sat" "sun") "weekend")
+    (("mon" "tue" "wed" "thu" "fri") "weekday")
+    (else "unknown")))
+
+(print (day-kind "sun"))
+(print (day-kind "wed"))
+(print (day-kind "someday"))
+
+; and/or stop at the first argument that decides the result.
+(defun safe-first (list)
+  (and (< 0 (length list)) (first list)))
+(print (safe-first '()))
+(print (safe-first '(1 2)))
+
+(when (< 1 2)
+  (print "when runs its body")
+  (print "in order"))
+(unless (< 1 2)
+  (print "never printed"))
+
+(defun count-down (n)
+  (cond ((= n 0) "done")
+        (else (count-down (- n 1)))))
+(print (count-down 100000))
@@ -0,0 +1,30 @@
+; Params and let bindings may be patterns that take lists apart.
+
+(defun swap ((a b))
+  (list b a))
+
+(print (swap '(1 2)))
+
+; A dot binds the rest of a list, both in patterns and in param lists.
+(defun head-and-tail ((x . xs))
+  (list x xs))
+
+(print (head-and-tail '(1 2 3)))
+
+(defun spread ((a b) c . others)
+  (list a b c others))
+
+(print (spread '(1 2) 3 4 5))
+
+; Patterns nest, and work in let, let* and letrec.
+(def entry '(ann (1990 4 12) admin staff))
+
+(let (((name (year month day) . roles) entry))
+  (print (list name year roles)))
+
+(let* (((first-role . more) (rest (rest entry)))
+       ((second-role) more))
+  (print (list first-role second-role)))
+
+; A value of the wrong shape is an error.
+(swap '(1 2 3))
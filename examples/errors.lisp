@@ -0,0 +1,13 @@
+; a runtime error reports the call stack
+(defun check (n)
+  (if (< n 0)
+    (first '())
+    n))
+(defun walk (list)
+  (if (empty list)
+    null
+    (seq
+      (check (first list))
+      (walk (rest list)))))
+(print "walking")
+(walk (cons 2 (cons 1 (cons (- 0 1) '()))))
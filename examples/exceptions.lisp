@@ -0,0 +1,52 @@
+; try runs its body, and if it fails, the first catch clause that accepts
+; the error. A clause names a kind of error, or _ for any error.
+
+(defun safe-div (a b)
+  (try (if (= b 0) (error "division by zero:" a) (quot a b))
+    (catch :user e (list 'failed (error-message e)))))
+
+(print (safe-div 10 2))
+(print (safe-div 1 0))
+
+; Errors raised by builtins can be caught too.
+(print (try (+ 1 "two") (catch :type e (error-message e))))
+(print (try (first '()) (catch _ e (list (error-kind e) (error? e)))))
+(print (try (substring "abc") (catch :arity e (error-kind e))))
+
+; throw raises any value, which the handler gets back as the payload.
+(defun find-first (pred list)
+  (try (seq (walk pred list) null)
+    (catch (fn (e) (= (error-kind e) :user)) e (error-payload e))))
+
+(defun walk (pred list)
+  (when (not (empty list))
+    (when (pred (first list))
+      (throw (first list)))
+    (walk pred (rest list))))
+
+(print (find-first (fn (x) (> x 10)) '(3 8 12 20)))
+(print (find-first (fn (x) (> x 100)) '(3 8 12 20)))
+
+; finally runs whether or not there was an error.
+(def events (box '()))
+(defun log (event) (set-box! events (cons event (unbox events))))
+
+(defun with-resource (thunk)
+  (seq (log 'open)
+       (try (thunk)
+         (finally (log 'close)))))
+
+(print (with-resource (fn () 'used)))
+(print (try (with-resource (fn () (throw 'broken)))
+         (catch _ e (error-payload e))))
+(print (unbox events))
+
+; A handler may throw the error on; it keeps the place it came from.
+(defun checked-sqrt (x)
+  (try (if (< x 0) (throw x) (sqrt x))
+    (catch :type e 'not-a-number)
+    (catch _ e (throw e))))
+
+(print (checked-sqrt 16))
+(print (checked-sqrt "x"))
+(checked-sqrt -4)
@@ -0,0 +1,28 @@
+; let evaluates its bindings in the enclosing scope, let* evaluates each
+; one in the scope of those before it, and letrec evaluates them all in
+; the new scope, so they can refer to each other.
+
+(def x 10)
+(print (let ((x 1) (y x)) (+ x y)))
+(print (let* ((x 1) (y x)) (+ x y)))
+(print x)
+
+(print
+  (letrec ((even (fn (n) (if (= n 0) #t (odd (- n 1)))))
+           (odd (fn (n) (if (= n 0) #f (even (- n 1))))))
+    (even 1000)))
+
+; defs in the body of a let stay inside it.
+(defun hypot (a b)
+  (let ((a2 (* a a))
+        (b2 (* b b)))
+    (def sum (+ a2 b2))
+    (sqrt sum)))
+(print (hypot 3 4))
+
+; each call gets its own bindings, which closures capture.
+(defun make-counter (start)
+  (let ((step 1))
+    (fn (n) (+ start (* n step)))))
+(def c (make-counter 100))
+(print (c 5))
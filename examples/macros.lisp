@@ -0,0 +1,33 @@
+; defmacro defines a function from code to code. Calls to a macro are
+; replaced by the code it returns before the program runs.
+
+(defmacro swap-if (test a b)
+  `(if ,test ,b ,a))
+
+(print (swap-if true 'first 'second))
+
+; The arguments are passed unevaluated, so a macro can delay them.
+(defmacro repeat (n body)
+  `(letrec ((loop (fn (i)
+                    (when (< i ,n)
+                      ,body
+                      (loop (+ i 1))))))
+     (loop 0)))
+
+(repeat 3 (print "hello"))
+
+; Macros may expand to definitions and to calls to other macros.
+(defmacro defconst (name val)
+  `(def ,name ,val))
+
+(defmacro defconsts (a b val)
+  `(seq (defconst ,a ,val) (defconst ,b ,val)))
+
+(defconsts zero nothing 0)
+(print (list zero nothing))
+
+; macroexpand-1 expands a form once, and macroexpand until it is no
+; longer a macro call.
+(print (macroexpand-1 '(defconsts x y 1)))
+(print (macroexpand '(defconst x 1)))
+(print (macroexpand '(print "not a macro")))
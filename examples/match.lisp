@@ -0,0 +1,68 @@
+; match picks the first clause whose pattern fits the value, binding the
+; names in the pattern to the parts of the value they match.
+
+(defun describe (x)
+  (match x
+    (0 "zero")
+    ("hello" "a greeting")
+    ('stop "the symbol stop")
+    (() "an empty list")
+    ((a) (concat "one element: " (number->string a)))
+    ((a b) (concat "a pair ending in " (number->string b)))
+    ((a . _) (concat "a longer list starting with " (number->string a)))
+    (_ "something else")))
+
+(print (describe 0))
+(print (describe "hello"))
+(print (describe 'stop))
+(print (describe '()))
+(print (describe '(7)))
+(print (describe '(1 2)))
+(print (describe '(5 6 7)))
+(print (describe 42))
+
+; A quoted list matches an equal list, and keywords match themselves.
+(defun command (cmd)
+  (match cmd
+    ('(go north) "heading north")
+    ((:go dir) (list 'going dir))
+    ((:say . words) (list 'saying words))
+    (_ 'unknown)))
+
+(print (command '(go north)))
+(print (command '(:go west)))
+(print (command '(:say hello there)))
+(print (command '(dance)))
+
+; (? pred pattern) matches a value that pred accepts and pattern matches.
+; The predicate may refer to names bound to its left.
+(defun positive? (n) (> n 0))
+
+(defun classify (point)
+  (match point
+    ((x (? (fn (y) (= x y)))) "on the diagonal")
+    (((? positive?) (? positive? y)) (list 'first-quadrant y))
+    ((? symbol? name) (list 'named name))
+    (_ 'elsewhere)))
+
+(print (classify '(3 3)))
+(print (classify '(1 2)))
+(print (classify '(-1 2)))
+(print (classify 'origin))
+
+; Patterns nest, so a tree can be walked by its shape.
+(defun eval-expr (e)
+  (match e
+    ((:add a b) (+ (eval-expr a) (eval-expr b)))
+    ((:mul a b) (* (eval-expr a) (eval-expr b)))
+    ((:neg (:neg a)) (eval-expr a))
+    ((:neg a) (- 0 (eval-expr a)))
+    (n n)))
+
+(print (eval-expr '(:add 1 (:mul 2 (:neg (:neg 3))))))
+(print (eval-expr '(:neg (:add 1 2))))
+
+; It is an error if no clause matches.
+(match '(1 2 3)
+  ((a b) 'pair)
+  (() 'empty))
@@ -0,0 +1,63 @@
+; set! updates a variable where it is defined, so closures can keep state.
+
+(defun make-counter ()
+  (let ((n 0))
+    (fn ()
+      (seq (set! n (+ n 1))
+           n))))
+
+(def tick (make-counter))
+(def tock (make-counter))
+(tick)
+(tick)
+(print (list (tick) (tock)))
+
+; set! reaches variables in enclosing scopes, including globals.
+(def total 0)
+
+(defun add-all (nums)
+  (when (not (empty nums))
+    (set! total (+ total (first nums)))
+    (add-all (rest nums))))
+
+(add-all '(1 2 3 4))
+(print total)
+
+; A box is a mutable value that can be passed around and shared.
+(defun make-account (balance)
+  (let ((b (box balance)))
+    (list (fn (amount) (seq (set-box! b (+ (unbox b) amount)) (unbox b)))
+          (fn () (unbox b)))))
+
+(let (((deposit balance) (make-account 100)))
+  (deposit 25)
+  (deposit 5)
+  (print (balance)))
+
+(def shared (box '()))
+(defun push (b x) (set-box! b (cons x (unbox b))))
+(push shared 'a)
+(push shared 'b)
+(print (unbox shared))
+(print (list (box? shared) (box? '()) (= shared shared) (= shared (box '(b a)))))
+
+; A memo table in a box makes a slow recursion fast.
+(defun lookup (key alist)
+  (cond ((empty alist) null)
+        ((= key (first (first alist))) (first (rest (first alist))))
+        (else (lookup key (rest alist)))))
+
+(def memo (box '()))
+
+(defun fib (n)
+  (or (lookup n (unbox memo))
+      (let ((val (if (< n 2) n (+ (fib (- n 1)) (fib (- n 2))))))
+        (set-box! memo (cons (list n val) (unbox memo)))
+        val)))
+
+(print (fib 80))
+
+; Assigning to a variable before it is defined is an error.
+(defun too-soon () (set! later 1))
+(too-soon)
+(def later 0)
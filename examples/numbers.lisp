@@ -0,0 +1,27 @@
+; ints are promoted to big ints instead of overflowing, and dividing ints
+; gives an exact fraction.
+
+(defun fact (n)
+  (if (< n 2)
+    1
+    (* n (fact (- n 1)))))
+
+(print (fact 25))
+(print (+ 9223372036854775807 1))
+(print (/ 10 4))
+(print (+ 1/3 2/3))
+(print (* 0.1 3))
+(print (sqrt 2))
+(print (sqrt 9/16))
+(print (expt 2 64))
+(print (mod 17 5))
+(print (quot 17 5))
+(print (floor 7/2))
+(print (max 2.5 (min 3 4)))
+
+; arithmetic and comparisons take any number of arguments.
+(print (+ 1 2 3 4))
+(print (- 5))
+(print (+ -1/2 -0.5))
+(print (< -1 0 1))
+(print (= 2 2 2.0))
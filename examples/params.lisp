@@ -0,0 +1,34 @@
+; Lambdas may take optional, rest and keyword parameters.
+
+; &optional params are null if no argument is given, unless they have a
+; default, which may refer to the params before it.
+(defun greet (name &optional (greeting "hello") (punct (if (= greeting "hello") "." "!")))
+  (concat greeting ", " name punct))
+
+(print (greet "ann"))
+(print (greet "ann" "hey"))
+(print (greet "ann" "hey" "?"))
+
+; A &rest param collects the remaining arguments into a list.
+(defun total (&rest xs)
+  (letrec ((loop (fn (xs acc)
+                   (if (empty xs) acc (loop (rest xs) (+ acc (first xs)))))))
+    (loop xs 0)))
+
+(print (total))
+(print (total 1 2 3 4))
+
+(defun log (fmt &rest args)
+  (list fmt args))
+
+(print (log "~a and ~a" 'x 'y))
+
+; &key params are passed by name as :name value pairs, in any order.
+(defun make-point (&key (x 0) (y 0) label)
+  (list label x y))
+
+(print (make-point))
+(print (make-point :y 2 :label 'p))
+
+; Bad calls are reported with the name of the function.
+(make-point :z 1)
@@ -0,0 +1,26 @@
+; mutual recursion between top-level functions
+(defun even (n)
+  (if (= n 0) (= 0 0) (odd (- n 1))))
+(defun odd (n)
+  (if (= n 0) (= 0 1) (even (- n 1))))
+(print (even 100))
+(print (odd 7))
+
+; tail calls run in constant stack
+(defun count (n acc)
+  (if (< n 1)
+    acc
+    (count (- n 1) (+ acc 2))))
+(print (count 100000 0))
+
+(defun length (list)
+  (if (empty list)
+    0
+    (+ 1 (length (rest list)))))
+(print (length '(1 2 3 4 5)))
+
+(defun reverse (list acc)
+  (if (empty list)
+    acc
+    (reverse (rest list) (cons (first list) acc))))
+(print (reverse '(1 2 3) '()))
@@ -0,0 +1,19 @@
+; string literals support \" \\ \n \t \r and \uXXXX escapes.
+
+(def csv "name,qty\nwidget,3\ngadget,12")
+
+(defun show (line)
+  (print (concat "| " (join (split line ",") "\t| ") " |")))
+
+(def lines (split csv "\n"))
+(show (first lines))
+(show (first (rest lines)))
+(print (length csv))
+(print (upcase (substring csv 0 4)))
+(print (index-of csv "gadget"))
+(print (replace "a-b-c" "-" "+"))
+(print (+ 1 (string->number "12")))
+(print (concat "total: " (number->string (* 3 1/2))))
+(print (trim "   padded   "))
+(print (< "apple" "banana" "cherry"))
+(print "café says \"hi\"")
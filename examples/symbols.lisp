@@ -0,0 +1,26 @@
+; quote returns data without evaluating it; names become symbols.
+
+(def inventory '((apples 3) (pears 0) (plums 12)))
+
+(defun lookup (key alist)
+  (cond ((empty alist) null)
+        ((= key (first (first alist))) (first (rest (first alist))))
+        (else (lookup key (rest alist)))))
+
+(print (lookup 'plums inventory))
+(print (lookup 'kiwis inventory))
+(print (symbol? (first (first inventory))))
+(print (symbol->string 'apples))
+(print (= (string->symbol "pears") 'pears))
+
+; list evaluates its arguments, quote does not.
+(print (list 1 (+ 1 1) 'three))
+(print '(1 (+ 1 1) three))
+(print ''nested)
+
+; quasiquote is quote with holes: ,x is evaluated and ,@xs is spliced in.
+(def n 3)
+(def more '(4 5))
+(print `(1 2 ,n ,@more))
+(print `(square ,n is ,(* n n)))
+(print `(nested (,n) ,@(list) end))
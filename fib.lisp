@@ -7,7 +7,7 @@
 ; syntax: list
 ; tokens: quotes
 ; types: list
-(def cases '(0 1 2 3 4 5 6 max))
+(def cases (list 0 1 2 3 4 5 6 max))
 (print cases)
 
 (print (< 5 (+ 2 1)))
@@ -0,0 +1,793 @@
+package interp
+
+import (
+	"fmt"
+	"strings"
+)
+
+type visitor interface {
+	visitCall(e *callExpr) error
+	visitFunc(e *funcExpr) error
+	visitDef(e *defExpr) error
+	visitDefun(e *defunExpr) error
+	visitSet(e *setExpr) error
+	visitDefmacro(e *defmacroExpr) error
+	visitMacro(e *macroExpr) error
+	visitIf(e *ifExpr) error
+	visitSeq(e *seqExpr) error
+	visitLet(e *letExpr) error
+	visitCond(e *condExpr) error
+	visitWhen(e *whenExpr) error
+	visitLogic(e *logicExpr) error
+	visitCase(e *caseExpr) error
+	visitMatch(e *matchExpr) error
+	visitTry(e *tryExpr) error
+	visitQuote(e *quoteExpr) error
+	visitQuasi(e *quasiExpr) error
+	visitIdent(e *identExpr) error
+	visitNum(e *numExpr) error
+	visitStr(e *strExpr) error
+	visitBool(e *boolExpr) error
+}
+
+// Expr := Call | Func | Def | Defun | Set | Defmacro | Macro | If | Seq
+//
+//	| Let | Cond | When | Logic | Case | Match | Try | Quote | Quasi | IDENT | NUM
+//	| STR | BOOL
+type expr interface {
+	fmt.Stringer
+	Span() Span
+	visit(v visitor) error
+}
+
+// Call := "(" Expr Expr* ")"
+type callExpr struct {
+	Fn   expr
+	Args []expr
+	Loc  Span
+}
+
+func (e *callExpr) visit(v visitor) error {
+	return v.visitCall(e)
+}
+
+func (e *callExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *callExpr) String() string {
+	return fmt.Sprintf("CallExpr(Fn=%s, Args=%s)", e.Fn, e.Args)
+}
+
+// patternKind distinguishes the shapes of value a pattern destructures.
+type patternKind int
+
+const (
+	namePattern     patternKind = iota + 1 // binds the whole value to a name
+	listPattern                            // destructures the elements of a list
+	mapPattern                             // destructures the values of a map
+	literalPattern                         // matches a value equal to Value
+	wildcardPattern                        // matches anything
+	predPattern                            // matches if Pred is true of the value
+)
+
+// Pattern := ident | "(" Pattern* ("." Pattern)? ")" | MapPattern
+// MapPattern := "(" "&map" (Literal Pattern)* ")"
+//
+// A pattern binds the parts of a value to the names at its leaves. A list
+// pattern matches a list with one element for each of Elems, or at least
+// that many if there is a Rest pattern after a dot, which matches the
+// list of the remaining elements. A map pattern matches a map that has
+// each of Keys, whose values are matched by the corresponding Elems.
+//
+// The other kinds of pattern are only used by match, where a pattern may
+// fail to match instead of being an error.
+type pattern struct {
+	Kind  patternKind
+	Name  *identExpr // for a namePattern
+	Elems []*pattern
+	Rest  *pattern // for a listPattern, nil if there is no dot
+	Keys  []Value  // for a mapPattern
+	Value Value    // for a literalPattern
+	Pred  expr     // for a predPattern, whose Elems hold at most one pattern
+	Loc   Span
+}
+
+// Names returns the names bound by pat, from left to right.
+func (pat *pattern) Names() []*identExpr {
+	if pat.Kind == namePattern {
+		return []*identExpr{pat.Name}
+	}
+	var names []*identExpr
+	for _, elem := range pat.Elems {
+		names = append(names, elem.Names()...)
+	}
+	if pat.Rest != nil {
+		names = append(names, pat.Rest.Names()...)
+	}
+	return names
+}
+
+// Preds returns the predicates of the PredPatterns in pat, from left to
+// right.
+func (pat *pattern) Preds() []expr {
+	var preds []expr
+	if pat.Kind == predPattern {
+		preds = append(preds, pat.Pred)
+	}
+	for _, elem := range pat.Elems {
+		preds = append(preds, elem.Preds()...)
+	}
+	if pat.Rest != nil {
+		preds = append(preds, pat.Rest.Preds()...)
+	}
+	return preds
+}
+
+// String formats pat as it is written.
+func (pat *pattern) String() string {
+	var words []string
+	switch pat.Kind {
+	case namePattern:
+		return pat.Name.Ident
+	case literalPattern:
+		return literalString(pat.Value)
+	case wildcardPattern:
+		return "_"
+	case predPattern:
+		pred := "..."
+		if ident, ok := pat.Pred.(*identExpr); ok {
+			pred = ident.Ident
+		}
+		words = append(words, "?", pred)
+		for _, elem := range pat.Elems {
+			words = append(words, elem.String())
+		}
+	case listPattern:
+		for _, elem := range pat.Elems {
+			words = append(words, elem.String())
+		}
+		if pat.Rest != nil {
+			words = append(words, ".", pat.Rest.String())
+		}
+	case mapPattern:
+		words = append(words, "&map")
+		for i, key := range pat.Keys {
+			words = append(words, literalString(key), pat.Elems[i].String())
+		}
+	}
+	return "(" + strings.Join(words, " ") + ")"
+}
+
+// literalString formats a literal in a pattern as it is written.
+func literalString(val Value) string {
+	switch val := val.(type) {
+	case StrVal:
+		return fmt.Sprintf("%q", string(val))
+	case SymVal:
+		if isKeywordArg(val.String()) {
+			return val.String()
+		}
+		return "'" + val.String()
+	}
+	return val.String()
+}
+
+// Params := "(" Pattern* Optional? Rest? Key? ")"
+// Optional := "&optional" OptParam*
+// Rest := "&rest" Pattern
+// Key := "&key" OptParam*
+// OptParam := ident | "(" ident Expr ")"
+//
+// paramList is the parameter list of a lambda. Arguments are bound to the
+// required parameters and then to the optional ones, in order; the rest
+// parameter is bound to a list of those left over, which for keyword
+// parameters must be pairs like :name value. Optional and keyword
+// parameters without an argument are bound to their default, or to null
+// if they have none. Defaults are evaluated in the lambda's frame, so they
+// can refer to the parameters before them.
+type paramList struct {
+	Required []*pattern
+	Optional []*optParam
+	Rest     *pattern // nil if there is no rest parameter
+	Key      []*optParam
+}
+
+type optParam struct {
+	Name    *identExpr
+	Default expr // nil if there is no default
+}
+
+func (p *optParam) String() string {
+	return fmt.Sprintf("OptParam(Name=%s, Default=%s)", p.Name, p.Default)
+}
+
+// Names returns the names bound by the parameters, in the order of their
+// frame slots.
+func (p *paramList) Names() []*identExpr {
+	var names []*identExpr
+	for _, pat := range p.Required {
+		names = append(names, pat.Names()...)
+	}
+	for _, opt := range p.Optional {
+		names = append(names, opt.Name)
+	}
+	if p.Rest != nil {
+		names = append(names, p.Rest.Names()...)
+	}
+	for _, key := range p.Key {
+		names = append(names, key.Name)
+	}
+	return names
+}
+
+// Defaults returns the optional and keyword parameters.
+func (p *paramList) Defaults() []*optParam {
+	return append(append([]*optParam(nil), p.Optional...), p.Key...)
+}
+
+// String formats the parameter names as they are written in a lambda.
+func (p *paramList) String() string {
+	if p == nil {
+		return ""
+	}
+	var words []string
+	for _, pat := range p.Required {
+		words = append(words, pat.String())
+	}
+	if len(p.Optional) > 0 {
+		words = append(words, "&optional")
+		for _, opt := range p.Optional {
+			words = append(words, opt.Name.Ident)
+		}
+	}
+	if p.Rest != nil {
+		words = append(words, "&rest", p.Rest.String())
+	}
+	if len(p.Key) > 0 {
+		words = append(words, "&key")
+		for _, key := range p.Key {
+			words = append(words, key.Name.Ident)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Defun := "(" "defun" ident Params Expr ")"
+type defunExpr struct {
+	Name   string
+	Params *paramList
+	Body   expr
+	Loc    Span
+	Ref    varRef   // where Name is defined, set by the resolver
+	Locals []string // frame slots of the body, set by the resolver
+}
+
+func (e *defunExpr) visit(v visitor) error {
+	return v.visitDefun(e)
+}
+
+func (e *defunExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *defunExpr) String() string {
+	return fmt.Sprintf("DefunExpr(Name=%s', Params=%s, Body=%s)", e.Name, e.Params, e.Body)
+}
+
+// Defmacro := "(" "defmacro" ident Params Expr ")"
+//
+// A macro is a function from data to data. Calls to it are read as data
+// and replaced by the code it returns before the program is resolved, so
+// the transformer Fn is evaluated when the defmacro is expanded rather
+// than when it is run, and can only see globals that are defined by then.
+type defmacroExpr struct {
+	Name string
+	Fn   *funcExpr
+	Loc  Span
+}
+
+func (e *defmacroExpr) visit(v visitor) error {
+	return v.visitDefmacro(e)
+}
+
+func (e *defmacroExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *defmacroExpr) String() string {
+	return fmt.Sprintf("DefmacroExpr(Name=%s, Fn=%s)", e.Name, e.Fn)
+}
+
+// Macro := "(" ident Datum* ")"
+//
+// A macroExpr is a call to a macro defined by an earlier defmacro. Its
+// arguments are read as data, and Expansion is set to the code the macro
+// returns for them when the program is expanded.
+type macroExpr struct {
+	Name      string
+	Args      ListVal
+	Loc       Span
+	Expansion expr
+}
+
+func (e *macroExpr) visit(v visitor) error {
+	return v.visitMacro(e)
+}
+
+func (e *macroExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *macroExpr) String() string {
+	return fmt.Sprintf("MacroExpr(Name=%s, Args=%s, Expansion=%s)", e.Name, e.Args, e.Expansion)
+}
+
+// Func := "(" "fn" Params Expr ")"
+type funcExpr struct {
+	Name   string // for the transformer of a defmacro, the macro's name
+	Params *paramList
+	Body   expr
+	Loc    Span
+	Locals []string // frame slots of the body, set by the resolver
+}
+
+func (e *funcExpr) visit(v visitor) error {
+	return v.visitFunc(e)
+}
+
+func (e *funcExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *funcExpr) String() string {
+	return fmt.Sprintf("FuncExpr(Params=%s, Body=%s)", e.Params, e.Body)
+}
+
+// Def := "(" "def" ident Expr ")"
+type defExpr struct {
+	Name    string
+	Binding expr
+	Loc     Span
+	Ref     varRef // where Name is defined, set by the resolver
+}
+
+func (e *defExpr) visit(v visitor) error {
+	return v.visitDef(e)
+}
+
+func (e *defExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *defExpr) String() string {
+	return fmt.Sprintf("DefExpr(Name=\"%s\", Binding=%s", e.Name, e.Binding)
+}
+
+// Set := "(" "set!" ident Expr ")"
+//
+// set! assigns to the variable that the name refers to, in the scope that
+// defines it, rather than defining a new one. It is an error if the
+// variable is not defined.
+type setExpr struct {
+	Name  *identExpr
+	Value expr
+	Loc   Span
+}
+
+func (e *setExpr) visit(v visitor) error {
+	return v.visitSet(e)
+}
+
+func (e *setExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *setExpr) String() string {
+	return fmt.Sprintf("SetExpr(Name=%s, Value=%s)", e.Name, e.Value)
+}
+
+// If := "(" "if" Expr Expr Expr ")"
+type ifExpr struct {
+	Antecedent expr
+	Consequent expr
+	Alternate  expr
+	Loc        Span
+}
+
+func (e *ifExpr) visit(v visitor) error {
+	return v.visitIf(e)
+}
+
+func (e *ifExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *ifExpr) String() string {
+	return fmt.Sprintf("IfExpr(Antecedent=%s, Consequent=%s, Alternate=%s)", e.Antecedent, e.Consequent, e.Alternate)
+}
+
+// Seq := "(" "seq" Expr* ")"
+type seqExpr struct {
+	Body []expr
+	Loc  Span
+}
+
+func (e *seqExpr) visit(v visitor) error {
+	return v.visitSeq(e)
+}
+
+func (e *seqExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *seqExpr) String() string {
+	return fmt.Sprintf("SeqExpr(Body=%s)", e.Body)
+}
+
+// letKind distinguishes the scoping rules of the let forms.
+type letKind int
+
+const (
+	letPlain letKind = iota + 1 // bindings are evaluated in the outer scope
+	letStar                     // each binding sees the ones before it
+	letRec                      // every binding sees all of them
+)
+
+func (kind letKind) String() string {
+	switch kind {
+	case letPlain:
+		return "let"
+	case letStar:
+		return "let*"
+	case letRec:
+		return "letrec"
+	}
+	return ""
+}
+
+// Let := "(" ("let" | "let*" | "letrec") "(" Binding* ")" Expr+ ")"
+// Binding := "(" Pattern Expr ")"
+//
+// The names are bound in a new frame, which is also where defs in the body
+// are bound. A body of several expressions is parsed as a seqExpr.
+type letExpr struct {
+	Kind     letKind
+	Patterns []*pattern
+	Inits    []expr
+	Body     expr
+	Loc      Span
+	Locals   []string // frame slots of the body, set by the resolver
+}
+
+func (e *letExpr) visit(v visitor) error {
+	return v.visitLet(e)
+}
+
+func (e *letExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *letExpr) String() string {
+	return fmt.Sprintf("LetExpr(Kind=%s, Patterns=%s, Inits=%s, Body=%s)", e.Kind, e.Patterns, e.Inits, e.Body)
+}
+
+// Cond := "(" "cond" Clause* ("(" "else" Expr+ ")")? ")"
+// Clause := "(" Expr Expr+ ")"
+//
+// The value is that of the body of the first clause whose test is true,
+// or of the else clause, or null if there is neither.
+type condExpr struct {
+	Clauses []*condClause
+	Else    expr // nil if there is no else clause
+	Loc     Span
+}
+
+type condClause struct {
+	Test expr
+	Body expr
+}
+
+func (c *condClause) String() string {
+	return fmt.Sprintf("CondClause(Test=%s, Body=%s)", c.Test, c.Body)
+}
+
+func (e *condExpr) visit(v visitor) error {
+	return v.visitCond(e)
+}
+
+func (e *condExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *condExpr) String() string {
+	return fmt.Sprintf("CondExpr(Clauses=%s, Else=%s)", e.Clauses, e.Else)
+}
+
+// When := "(" ("when" | "unless") Expr Expr+ ")"
+//
+// The body is evaluated if the test is true (for when) or false (for
+// unless). Otherwise the value is null.
+type whenExpr struct {
+	Unless bool
+	Test   expr
+	Body   expr
+	Loc    Span
+}
+
+func (e *whenExpr) visit(v visitor) error {
+	return v.visitWhen(e)
+}
+
+func (e *whenExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *whenExpr) String() string {
+	return fmt.Sprintf("WhenExpr(Unless=%t, Test=%s, Body=%s)", e.Unless, e.Test, e.Body)
+}
+
+// Logic := "(" ("and" | "or") Expr* ")"
+//
+// The arguments are evaluated from left to right, stopping at the first
+// false one (for and) or true one (for or), whose value is the result.
+// Otherwise the result is the value of the last argument, which is in
+// tail position. (and) is true and (or) is false.
+type logicExpr struct {
+	Or   bool
+	Args []expr
+	Loc  Span
+}
+
+func (e *logicExpr) visit(v visitor) error {
+	return v.visitLogic(e)
+}
+
+func (e *logicExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *logicExpr) String() string {
+	return fmt.Sprintf("LogicExpr(Or=%t, Args=%s)", e.Or, e.Args)
+}
+
+// Case := "(" "case" Expr CaseClause* ("(" "else" Expr+ ")")? ")"
+// CaseClause := "(" (Literal | "(" Literal* ")") Expr+ ")"
+//
+// The value is that of the body of the first clause with a literal equal
+// to the key, or of the else clause, or null if there is neither.
+type caseExpr struct {
+	Key     expr
+	Clauses []*caseClause
+	Else    expr // nil if there is no else clause
+	Loc     Span
+}
+
+type caseClause struct {
+	Values ListVal
+	Body   expr
+}
+
+func (c *caseClause) String() string {
+	return fmt.Sprintf("CaseClause(Values=%s, Body=%s)", c.Values, c.Body)
+}
+
+func (e *caseExpr) visit(v visitor) error {
+	return v.visitCase(e)
+}
+
+func (e *caseExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *caseExpr) String() string {
+	return fmt.Sprintf("CaseExpr(Key=%s, Clauses=%s, Else=%s)", e.Key, e.Clauses, e.Else)
+}
+
+// Match := "(" "match" Expr MatchClause* ")"
+// MatchClause := "(" MatchPattern Expr+ ")"
+// MatchPattern := "_" | ident | Literal | QUOTE Datum | ListMatch | Pred
+// ListMatch := "(" MatchPattern* ("." MatchPattern)? ")"
+// ListMatch := "(" "&map" (Literal MatchPattern)* ")"
+// Pred := "(" "?" Expr MatchPattern? ")"
+//
+// The value is that of the body of the first clause whose pattern matches
+// the subject, with the names in the pattern bound to the parts of the
+// subject they match. It is an error if no clause matches. A quoted datum
+// matches an equal one, and (? pred pat) matches a value for which pred
+// returns true and which pat matches; pred may refer to the names bound
+// to its left in the pattern.
+type matchExpr struct {
+	Subject expr
+	Clauses []*matchClause
+	Loc     Span
+}
+
+type matchClause struct {
+	Pattern *pattern
+	Body    expr
+	Locals  []string // frame slots of the pattern and body, set by the resolver
+}
+
+func (c *matchClause) String() string {
+	return fmt.Sprintf("MatchClause(Pattern=%s, Body=%s)", c.Pattern, c.Body)
+}
+
+func (e *matchExpr) visit(v visitor) error {
+	return v.visitMatch(e)
+}
+
+func (e *matchExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *matchExpr) String() string {
+	return fmt.Sprintf("MatchExpr(Subject=%s, Clauses=%s)", e.Subject, e.Clauses)
+}
+
+// Try := "(" "try" Expr+ Catch* Finally? ")"
+// Catch := "(" "catch" Selector ident Expr+ ")"
+// Selector := "_" | KEYWORD_ARG | Expr
+// Finally := "(" "finally" Expr+ ")"
+//
+// The value is that of the body, unless it fails with an error. Then the
+// first catch clause whose selector accepts the error runs with the error
+// bound to its name, and gives the value instead; if none does, the error
+// is raised again. A selector accepts any error if it is _, the errors of
+// the kind it names if it is a keyword like :type, and otherwise the errors
+// that it returns true for when called as a predicate. The finally clause
+// runs last whether or not there was an error, and its value is ignored.
+type tryExpr struct {
+	Body    expr
+	Catches []*catchClause
+	Finally expr // nil if there is no finally clause
+	Loc     Span
+}
+
+type catchClause struct {
+	Kind   ErrorKind // the kind of error caught, or 0 to use Pred
+	Pred   expr      // nil to catch any error
+	Name   *identExpr
+	Body   expr
+	Locals []string // frame slots of the body, set by the resolver
+}
+
+func (c *catchClause) String() string {
+	sel := "_"
+	if c.Kind != 0 {
+		sel = c.Kind.Name()
+	} else if c.Pred != nil {
+		sel = c.Pred.String()
+	}
+	return fmt.Sprintf("CatchClause(Selector=%s, Name=%s, Body=%s)", sel, c.Name, c.Body)
+}
+
+func (e *tryExpr) visit(v visitor) error {
+	return v.visitTry(e)
+}
+
+func (e *tryExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *tryExpr) String() string {
+	return fmt.Sprintf("TryExpr(Body=%s, Catches=%s, Finally=%s)", e.Body, e.Catches, e.Finally)
+}
+
+// Quote := QUOTE Datum | "(" "quote" Datum ")"
+// Datum := "(" Datum* ")" | QUOTE Datum | ident | NUM | STR | BOOL
+//
+// The value of a quote is its datum, unevaluated: identifiers are read as
+// symbols (except null, which is null) and parenthesized data as lists.
+type quoteExpr struct {
+	Datum Value
+	Loc   Span
+}
+
+func (e *quoteExpr) visit(v visitor) error {
+	return v.visitQuote(e)
+}
+
+func (e *quoteExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *quoteExpr) String() string {
+	return fmt.Sprintf("QuoteExpr(%s)", e.Datum)
+}
+
+// Quasi := QUASIQUOTE Template
+// Template := "(" Elem* ")" | (QUOTE | QUASIQUOTE) Template | UNQUOTE Expr | Datum
+// Elem := Template | SPLICE Expr
+//
+// A quasiExpr builds a list from a template that contains unquoted
+// expressions. Elem i is an expression for the i-th element, or if
+// Splice[i] is set, for a list whose elements are spliced in. The parser
+// turns the parts of a template without unquotes into QuoteExprs, so a
+// template without any is just a quoteExpr.
+type quasiExpr struct {
+	Elems  []expr
+	Splice []bool
+	Loc    Span
+}
+
+func (e *quasiExpr) visit(v visitor) error {
+	return v.visitQuasi(e)
+}
+
+func (e *quasiExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *quasiExpr) String() string {
+	return fmt.Sprintf("QuasiExpr(Elems=%s, Splice=%v)", e.Elems, e.Splice)
+}
+
+type identExpr struct {
+	Ident string
+	Loc   Span
+	Ref   varRef // set by the resolver
+}
+
+func (e *identExpr) visit(v visitor) error {
+	return v.visitIdent(e)
+}
+
+func (e *identExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *identExpr) String() string {
+	return fmt.Sprintf("IdentExpr(\"%s\")", e.Ident)
+}
+
+type numExpr struct {
+	Num Value
+	Loc Span
+}
+
+func (e *numExpr) visit(v visitor) error {
+	return v.visitNum(e)
+}
+
+func (e *numExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *numExpr) String() string {
+	return fmt.Sprintf("NumExpr(%s)", e.Num)
+}
+
+type strExpr struct {
+	Str string
+	Loc Span
+}
+
+func (e *strExpr) visit(v visitor) error {
+	return v.visitStr(e)
+}
+
+func (e *strExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *strExpr) String() string {
+	return fmt.Sprintf("StrExpr(%q)", e.Str)
+}
+
+type boolExpr struct {
+	Bool bool
+	Loc  Span
+}
+
+func (e *boolExpr) visit(v visitor) error {
+	return v.visitBool(e)
+}
+
+func (e *boolExpr) Span() Span {
+	return e.Loc
+}
+
+func (e *boolExpr) String() string {
+	return fmt.Sprintf("BoolExpr(%t)", e.Bool)
+}
@@ -0,0 +1,326 @@
+package interp
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// builtIns are the functions available to every program. Functions that
+// do I/O are defined per Interp instead, see New.
+var builtIns = map[string]BuiltInFuncVal{
+	"<":     compareBuiltin("<", func(cmp int) bool { return cmp < 0 }),
+	">":     compareBuiltin(">", func(cmp int) bool { return cmp > 0 }),
+	"<=":    compareBuiltin("<=", func(cmp int) bool { return cmp <= 0 }),
+	">=":    compareBuiltin(">=", func(cmp int) bool { return cmp >= 0 }),
+	"+":     arithBuiltin(0, NumVal(0), addOp),
+	"-":     arithBuiltin(1, NumVal(0), subOp),
+	"*":     arithBuiltin(0, NumVal(1), mulOp),
+	"/":     foldBuiltin(1, NumVal(1), divide),
+	"quot":  integerBuiltin("quot", quotOp),
+	"mod":   integerBuiltin("mod", modOp),
+	"abs":   {params: []ValType{NumT}, f: abs},
+	"min":   foldBuiltin(1, nil, minimum),
+	"max":   foldBuiltin(1, nil, maximum),
+	"floor": {params: []ValType{NumT}, f: floor},
+	"sqrt":  {params: []ValType{NumT}, f: sqrt},
+	"expt":  {params: []ValType{NumT, NumT}, f: expt},
+	"=": {params: []ValType{AnyT, AnyT}, variadic: true, f: func(args ...Value) (Value, error) {
+		for i := 1; i < len(args); i++ {
+			eq, err := equal(args[i-1], args[i])
+			if err != nil || !eq {
+				return BoolVal(false), err
+			}
+		}
+		return BoolVal(true), nil
+	}},
+	"concat": {params: []ValType{StrT}, variadic: true, f: func(args ...Value) (Value, error) {
+		var b strings.Builder
+		for _, arg := range args {
+			b.WriteString(string(arg.(StrVal)))
+		}
+		return StrVal(b.String()), nil
+	}},
+	"length": {params: []ValType{AnyT}, f: func(args ...Value) (Value, error) {
+		switch arg := args[0].(type) {
+		case StrVal:
+			return NumVal(utf8.RuneCountInString(string(arg))), nil
+		case ListVal:
+			return NumVal(len(arg)), nil
+		}
+		return nil, newError(TypeErr, "length: argument 1 must be str or list, got %s", args[0].Type())
+	}},
+	"substring": {params: []ValType{StrT, NumT, NumT}, optional: 1, f: func(args ...Value) (Value, error) {
+		s := []rune(string(args[0].(StrVal)))
+		start, err := index("substring", 2, args[1], len(s))
+		if err != nil {
+			return nil, err
+		}
+		end := len(s)
+		if len(args) == 3 {
+			if end, err = index("substring", 3, args[2], len(s)); err != nil {
+				return nil, err
+			}
+		}
+		if start > end {
+			return nil, newError(EvalErr, "substring: start %d is after end %d", start, end)
+		}
+		return StrVal(s[start:end]), nil
+	}},
+	"index-of": {params: []ValType{StrT, StrT}, f: func(args ...Value) (Value, error) {
+		s, sub := string(args[0].(StrVal)), string(args[1].(StrVal))
+		i := strings.Index(s, sub)
+		if i < 0 {
+			return NumVal(-1), nil
+		}
+		return NumVal(utf8.RuneCountInString(s[:i])), nil
+	}},
+	"split": {params: []ValType{StrT, StrT}, f: func(args ...Value) (Value, error) {
+		var parts ListVal
+		for _, part := range strings.Split(string(args[0].(StrVal)), string(args[1].(StrVal))) {
+			parts = append(parts, StrVal(part))
+		}
+		return parts, nil
+	}},
+	"join": {params: []ValType{ListT, StrT}, f: func(args ...Value) (Value, error) {
+		var parts []string
+		for i, elem := range args[0].(ListVal) {
+			s, ok := elem.(StrVal)
+			if !ok {
+				return nil, newError(TypeErr, "join: element %d must be str, got %s", i+1, elem.Type())
+			}
+			parts = append(parts, string(s))
+		}
+		return StrVal(strings.Join(parts, string(args[1].(StrVal)))), nil
+	}},
+	"upcase": {params: []ValType{StrT}, f: func(args ...Value) (Value, error) {
+		return StrVal(strings.ToUpper(string(args[0].(StrVal)))), nil
+	}},
+	"downcase": {params: []ValType{StrT}, f: func(args ...Value) (Value, error) {
+		return StrVal(strings.ToLower(string(args[0].(StrVal)))), nil
+	}},
+	"trim": {params: []ValType{StrT}, f: func(args ...Value) (Value, error) {
+		return StrVal(strings.TrimSpace(string(args[0].(StrVal)))), nil
+	}},
+	"replace": {params: []ValType{StrT, StrT, StrT}, f: func(args ...Value) (Value, error) {
+		s, old, new := string(args[0].(StrVal)), string(args[1].(StrVal)), string(args[2].(StrVal))
+		return StrVal(strings.Replace(s, old, new, -1)), nil
+	}},
+	"string->number": {params: []ValType{StrT}, f: func(args ...Value) (Value, error) {
+		num, err := parseNum(strings.TrimSpace(string(args[0].(StrVal))))
+		if err != nil {
+			return BoolVal(false), nil
+		}
+		return num, nil
+	}},
+	"number->string": {params: []ValType{NumT}, f: func(args ...Value) (Value, error) {
+		return StrVal(args[0].String()), nil
+	}},
+	"not": {params: []ValType{AnyT}, f: func(args ...Value) (Value, error) {
+		return BoolVal(!isTrue(args[0])), nil
+	}},
+	"list": {params: []ValType{AnyT}, variadic: true, f: func(args ...Value) (Value, error) {
+		return append(ListVal{}, args...), nil
+	}},
+	"number?": typePredicate(NumT),
+	"string?": typePredicate(StrT),
+	"bool?":   typePredicate(BoolT),
+	"list?":   typePredicate(ListT),
+	"map?":    typePredicate(MapT),
+	"fn?":     typePredicate(FuncT),
+	"null?":   typePredicate(NullT),
+	"symbol?": typePredicate(SymT),
+	"symbol->string": {params: []ValType{SymT}, f: func(args ...Value) (Value, error) {
+		return StrVal(args[0].(SymVal).Value()), nil
+	}},
+	"string->symbol": {params: []ValType{StrT}, f: func(args ...Value) (Value, error) {
+		return Intern(string(args[0].(StrVal))), nil
+	}},
+	"box": {params: []ValType{AnyT}, f: func(args ...Value) (Value, error) {
+		return NewBox(args[0]), nil
+	}},
+	"box?": typePredicate(BoxT),
+	"unbox": {params: []ValType{BoxT}, f: func(args ...Value) (Value, error) {
+		return args[0].(BoxVal).Value(), nil
+	}},
+	"set-box!": {params: []ValType{BoxT, AnyT}, f: func(args ...Value) (Value, error) {
+		args[0].(BoxVal).Set(args[1])
+		return Null, nil
+	}},
+	"throw": {params: []ValType{AnyT}, f: func(args ...Value) (Value, error) {
+		if e, ok := args[0].(ErrorVal); ok {
+			return nil, e.err
+		}
+		err := newError(UserErr, "throw: %s", args[0])
+		err.Payload = args[0]
+		return nil, err
+	}},
+	"error": {params: []ValType{StrT, AnyT}, variadic: true, f: func(args ...Value) (Value, error) {
+		words := []string{string(args[0].(StrVal))}
+		for _, arg := range args[1:] {
+			words = append(words, arg.String())
+		}
+		err := newError(UserErr, "%s", strings.Join(words, " "))
+		err.Payload = append(ListVal{}, args[1:]...)
+		return nil, err
+	}},
+	"error?": typePredicate(ErrorT),
+	"error-kind": {params: []ValType{ErrorT}, f: func(args ...Value) (Value, error) {
+		return Intern(args[0].(ErrorVal).Kind().Name()), nil
+	}},
+	"error-message": {params: []ValType{ErrorT}, f: func(args ...Value) (Value, error) {
+		return StrVal(args[0].(ErrorVal).Message()), nil
+	}},
+	"error-payload": {params: []ValType{ErrorT}, f: func(args ...Value) (Value, error) {
+		return args[0].(ErrorVal).Payload(), nil
+	}},
+	"cons": {params: []ValType{AnyT, ListT}, f: func(args ...Value) (Value, error) {
+		elem := args[0]
+		list := args[1].(ListVal)
+		return ListVal(append([]Value{elem}, list...)), nil
+	}},
+	"first": {params: []ValType{ListT}, f: func(args ...Value) (Value, error) {
+		list := args[0].(ListVal)
+		if len(list) == 0 {
+			return nil, newError(TypeErr, "first: empty list")
+		}
+		return list.Value()[0], nil
+	}},
+	"rest": {params: []ValType{ListT}, f: func(args ...Value) (Value, error) {
+		list := args[0].(ListVal)
+		if len(list) == 0 {
+			return nil, newError(TypeErr, "rest: empty list")
+		}
+		return ListVal(list[1:]), nil
+	}},
+	"empty": {params: []ValType{ListT}, f: func(args ...Value) (Value, error) {
+		list := args[0].(ListVal)
+		return BoolVal(len(list.Value()) == 0), nil
+	}},
+}
+
+// typePredicate makes a builtin that reports whether its argument has
+// type typ.
+func typePredicate(typ ValType) BuiltInFuncVal {
+	return BuiltInFuncVal{params: []ValType{AnyT}, f: func(args ...Value) (Value, error) {
+		return BoolVal(args[0].Type() == typ), nil
+	}}
+}
+
+// equal reports whether a and b are equal. They must both be numbers, both
+// be strings, both be bools, both be symbols, both be null or both be
+// boxes, which are equal only if they are the same box.
+func equal(a, b Value) (bool, error) {
+	switch a.Type() {
+	case NumT:
+		if b.Type() != NumT {
+			return false, newError(TypeErr, "type mismatch: %s and %s", a, b)
+		}
+		cmp, ok := compareNums(a, b)
+		return ok && cmp == 0, nil
+	case StrT:
+		if b.Type() != StrT {
+			return false, newError(TypeErr, "type mismatch: %s and %s", a, b)
+		}
+		return a.(StrVal) == b.(StrVal), nil
+	case SymT:
+		if b.Type() != SymT {
+			return false, newError(TypeErr, "type mismatch: %s and %s", a, b)
+		}
+		return a.(SymVal) == b.(SymVal), nil
+	case BoolT:
+		if b.Type() != BoolT {
+			return false, newError(TypeErr, "type mismatch: %s and %s", a, b)
+		}
+		return a.(BoolVal) == b.(BoolVal), nil
+	case NullT:
+		if _, ok := b.(NullVal); !ok {
+			return false, newError(TypeErr, "type mismatch: %s and %s", a, b)
+		}
+		return true, nil
+	case BoxT:
+		if b.Type() != BoxT {
+			return false, newError(TypeErr, "type mismatch: %s and %s", a, b)
+		}
+		return a.(BoxVal) == b.(BoxVal), nil
+	}
+	return false, newError(TypeErr, "bad type for '=': %s", a)
+}
+
+// eqv reports whether a and b are equal as case compares them: like equal,
+// except that values of different types are simply not equal.
+func eqv(a, b Value) bool {
+	eq, err := equal(a, b)
+	return err == nil && eq
+}
+
+// compare returns -1, 0 or 1 as a is less than, equal to or greater than
+// b, which must both be numbers or both be strings. Strings are ordered
+// by bytes. If a or b is NaN they are unordered and ok is false.
+func compare(name string, a, b Value) (cmp int, ok bool, err error) {
+	switch {
+	case a.Type() == NumT && b.Type() == NumT:
+		cmp, ok = compareNums(a, b)
+		return cmp, ok, nil
+	case a.Type() == StrT && b.Type() == StrT:
+		return strings.Compare(string(a.(StrVal)), string(b.(StrVal))), true, nil
+	case a.Type() != NumT && a.Type() != StrT:
+		return 0, false, newError(TypeErr, "bad type for '%s': %s", name, a.Type())
+	}
+	return 0, false, newError(TypeErr, "type mismatch: %s and %s", a, b)
+}
+
+// compareBuiltin makes a chained comparison builtin taking one or more
+// numbers or strings, so (< a b c) means a < b and b < c. It is true when
+// test holds for the result of compare on each adjacent pair.
+func compareBuiltin(name string, test func(cmp int) bool) BuiltInFuncVal {
+	return BuiltInFuncVal{params: []ValType{AnyT, AnyT}, variadic: true, f: func(args ...Value) (Value, error) {
+		if len(args) == 1 {
+			if _, _, err := compare(name, args[0], args[0]); err != nil {
+				return nil, err
+			}
+		}
+		for i := 1; i < len(args); i++ {
+			cmp, ok, err := compare(name, args[i-1], args[i])
+			if err != nil || !ok || !test(cmp) {
+				return BoolVal(false), err
+			}
+		}
+		return BoolVal(true), nil
+	}}
+}
+
+// index checks that the argument at position i of the builtin name is an
+// index into a sequence of length n. n itself is allowed, to index the end.
+func index(name string, i int, arg Value, n int) (int, error) {
+	idx, ok := arg.(NumVal)
+	if !ok {
+		return 0, newError(TypeErr, "%s: argument %d must be an integer, got %s", name, i, arg)
+	}
+	if idx < 0 || int(idx) > n {
+		return 0, newError(EvalErr, "%s: index %d out of range [0, %d]", name, idx, n)
+	}
+	return int(idx), nil
+}
+
+// builtinTable holds the builtins in the slots recorded in builtinSlots,
+// which is how resolved programs refer to them. They are stored as Values,
+// so that loading one does not allocate.
+var (
+	builtinTable []Value
+	builtinSlots = make(map[string]int)
+)
+
+func init() {
+	var names []string
+	for name, fn := range builtIns {
+		fn.name = name
+		builtIns[name] = fn
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		builtinSlots[name] = len(builtinTable)
+		builtinTable = append(builtinTable, builtIns[name])
+	}
+}
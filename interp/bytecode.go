@@ -0,0 +1,228 @@
+package interp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type opcode byte
+
+// Operands are encoded after the opcode, big-endian. Jump targets are
+// absolute offsets into the code of the enclosing prototype.
+const (
+	opConst            opcode = iota + 1 // idx:u16; push Consts[idx]
+	opNull                               // push null
+	opPop                                // discard the top of the stack
+	opDup                                // push the top of the stack again
+	opSwap                               // exchange the top two values
+	opLoadLocal                          // depth:u8 slot:u16; push a local
+	opStoreLocal                         // depth:u8 slot:u16; pop into a local
+	opSetLocal                           // depth:u8 slot:u16; pop into a local that must be defined
+	opLoadGlobal                         // name:u16; push the global Consts[name]
+	opDefGlobal                          // name:u16; pop into the global Consts[name]
+	opSetGlobal                          // name:u16; pop into the global Consts[name], which must be defined
+	opLoadBuiltin                        // slot:u16; push builtinTable[slot]
+	opJump                               // target:u16
+	opJumpIfFalse                        // target:u16; pop a condition, jump if false
+	opJumpIfFalseOrPop                   // target:u16; jump if the top is false, else pop it
+	opJumpIfTrueOrPop                    // target:u16; jump if the top is true, else pop it
+	opJumpIfBound                        // target:u16 slot:u16; jump if a local has a value
+	opMember                             // list:u16; push whether the top is in Consts[list]
+	opList                               // n:u16; pop n values and push a list of them
+	opAppend                             // n:u16; pop n lists and push their concatenation
+	opCall                               // argc:u16; call fn with argc args
+	opTailCall                           // argc:u16; call, replacing the current frame
+	opReturn                             // return the top of the stack
+	opClosure                            // proto:u16; push a closure over Protos[proto]
+	opEnter                              // env:u16; push a frame with the slots Envs[env]
+	opLeave                              // pop the frame pushed by opEnter
+	opDestructure                        // pattern:u16; pop a value and bind Patterns[pattern] to it
+	opMatchConst                         // target:u16 const:u16; pop a value, jump if it is not Consts[const]
+	opMatchList                          // target:u16 n:u16 rest:u8; pop a list and push its parts, or jump
+	opMatchMap                           // target:u16 keys:u16; pop a map and push its values at Consts[keys], or jump
+	opNoMatch                            // fail because no clause of a match matched the top
+	opTry                                // handler:u16; on an error, unwind to here and jump to handler with it pushed
+	opEndTry                             // remove the handler added by the last opTry
+	opThrow                              // pop an error and raise it again
+	opJumpUnlessKind                     // target:u16 kind:u8; jump if the error on top is not of the kind
+)
+
+var opNames = map[opcode]string{
+	opConst:            "CONST",
+	opNull:             "NULL",
+	opPop:              "POP",
+	opDup:              "DUP",
+	opSwap:             "SWAP",
+	opLoadLocal:        "LOAD_LOCAL",
+	opStoreLocal:       "STORE_LOCAL",
+	opSetLocal:         "SET_LOCAL",
+	opLoadGlobal:       "LOAD_GLOBAL",
+	opDefGlobal:        "DEF_GLOBAL",
+	opSetGlobal:        "SET_GLOBAL",
+	opLoadBuiltin:      "LOAD_BUILTIN",
+	opJump:             "JUMP",
+	opJumpIfFalse:      "JUMP_IF_FALSE",
+	opJumpIfFalseOrPop: "JUMP_IF_FALSE_OR_POP",
+	opJumpIfTrueOrPop:  "JUMP_IF_TRUE_OR_POP",
+	opJumpIfBound:      "JUMP_IF_BOUND",
+	opMember:           "MEMBER",
+	opList:             "LIST",
+	opAppend:           "APPEND",
+	opCall:             "CALL",
+	opTailCall:         "TAIL_CALL",
+	opReturn:           "RETURN",
+	opClosure:          "CLOSURE",
+	opEnter:            "ENTER",
+	opLeave:            "LEAVE",
+	opDestructure:      "DESTRUCTURE",
+	opMatchConst:       "MATCH_CONST",
+	opMatchList:        "MATCH_LIST",
+	opMatchMap:         "MATCH_MAP",
+	opNoMatch:          "NO_MATCH",
+	opTry:              "TRY",
+	opEndTry:           "END_TRY",
+	opThrow:            "THROW",
+	opJumpUnlessKind:   "JUMP_UNLESS_KIND",
+}
+
+// opOperands lists the byte width of each operand of an opcode.
+var opOperands = map[opcode][]int{
+	opConst:            {2},
+	opLoadLocal:        {1, 2},
+	opStoreLocal:       {1, 2},
+	opSetLocal:         {1, 2},
+	opLoadGlobal:       {2},
+	opDefGlobal:        {2},
+	opSetGlobal:        {2},
+	opLoadBuiltin:      {2},
+	opJump:             {2},
+	opJumpIfFalse:      {2},
+	opJumpIfFalseOrPop: {2},
+	opJumpIfTrueOrPop:  {2},
+	opJumpIfBound:      {2, 2},
+	opMember:           {2},
+	opList:             {2},
+	opAppend:           {2},
+	opCall:             {2},
+	opTailCall:         {2},
+	opClosure:          {2},
+	opEnter:            {2},
+	opDestructure:      {2},
+	opMatchConst:       {2, 2},
+	opMatchList:        {2, 2, 1},
+	opMatchMap:         {2, 2},
+	opTry:              {2},
+	opJumpUnlessKind:   {2, 1},
+}
+
+func (op opcode) String() string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP(%d)", byte(op))
+}
+
+type codeLoc struct {
+	pc  int
+	loc Span
+}
+
+// prototype is a compiled lambda body or top-level expression.
+type prototype struct {
+	Name     string
+	Top      bool // compiled from a top-level expression rather than a lambda
+	Params   *paramList
+	Arity    int      // number of params if they are all required names, or -1
+	Captures bool     // whether the code makes closures, which may keep its frames
+	Locals   []string // names of the frame slots; params come first
+	Code     []byte
+	Consts   []Value
+	Protos   []*prototype
+	Envs     [][]string // slot names of the frames pushed by opEnter
+	Patterns []*pattern // patterns bound by opDestructure
+	locs     []codeLoc  // source spans, sorted by pc
+}
+
+// locAt returns the span of the expression that emitted the instruction
+// at pc.
+func (p *prototype) locAt(pc int) Span {
+	var loc Span
+	for _, l := range p.locs {
+		if l.pc > pc {
+			break
+		}
+		loc = l.loc
+	}
+	return loc
+}
+
+// name returns the name given by defun, or "fn" for anonymous lambdas.
+func (p *prototype) name() string {
+	if p.Name == "" {
+		return "fn"
+	}
+	return p.Name
+}
+
+func (p *prototype) String() string {
+	return fmt.Sprintf("%s(%s)", p.name(), p.Params)
+}
+
+// readOperands decodes the operands of the instruction at pc and returns
+// them along with the offset of the next instruction.
+func (p *prototype) readOperands(pc int) ([]int, int) {
+	op := opcode(p.Code[pc])
+	pc++
+	var operands []int
+	for _, width := range opOperands[op] {
+		switch width {
+		case 1:
+			operands = append(operands, int(p.Code[pc]))
+		case 2:
+			operands = append(operands, int(binary.BigEndian.Uint16(p.Code[pc:])))
+		}
+		pc += width
+	}
+	return operands, pc
+}
+
+// disassemble writes a listing of p and every prototype nested in it.
+func disassemble(w io.Writer, p *prototype) {
+	if p.Top {
+		fmt.Fprintf(w, "== top level (%d slots)\n", len(p.Locals))
+	} else {
+		fmt.Fprintf(w, "== %s (%d slots)\n", p, len(p.Locals))
+	}
+	for pc := 0; pc < len(p.Code); {
+		op := opcode(p.Code[pc])
+		operands, next := p.readOperands(pc)
+		var args []string
+		for _, operand := range operands {
+			args = append(args, fmt.Sprint(operand))
+		}
+		line := fmt.Sprintf("%04d  %-14s %s", pc, op, strings.Join(args, " "))
+		switch op {
+		case opConst, opLoadGlobal, opDefGlobal, opSetGlobal, opMember:
+			line += fmt.Sprintf("\t; %s", p.Consts[operands[0]])
+		case opLoadBuiltin:
+			line += fmt.Sprintf("\t; %s", builtinTable[operands[0]].(BuiltInFuncVal).name)
+		case opClosure:
+			line += fmt.Sprintf("\t; %s", p.Protos[operands[0]])
+		case opEnter:
+			line += fmt.Sprintf("\t; %s", strings.Join(p.Envs[operands[0]], " "))
+		case opDestructure:
+			line += fmt.Sprintf("\t; %s", p.Patterns[operands[0]])
+		case opMatchConst, opMatchMap:
+			line += fmt.Sprintf("\t; %s", p.Consts[operands[1]])
+		case opJumpUnlessKind:
+			line += fmt.Sprintf("\t; %s", ErrorKind(operands[1]).Name())
+		}
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+		pc = next
+	}
+	for _, nested := range p.Protos {
+		disassemble(w, nested)
+	}
+}
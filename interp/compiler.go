@@ -0,0 +1,751 @@
+package interp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// compiler translates expressions annotated by the resolver to bytecode
+// for the VM.
+type compiler struct {
+	proto   *prototype
+	globals map[string]int // constant index of each global name
+	loc     Span
+	tail    bool
+}
+
+// compile compiles a resolved top-level expression.
+func compile(e expr) (*prototype, error) {
+	c := newCompiler(&prototype{Top: true})
+	if err := c.compile(e, true); err != nil {
+		return nil, err
+	}
+	c.emit(opReturn)
+	return c.proto, nil
+}
+
+func newCompiler(proto *prototype) *compiler {
+	return &compiler{proto: proto, globals: make(map[string]int)}
+}
+
+func (c *compiler) compile(e expr, tail bool) error {
+	loc, wasTail := c.loc, c.tail
+	c.loc, c.tail = e.Span(), tail
+	err := e.visit(c)
+	c.loc, c.tail = loc, wasTail
+	return err
+}
+
+func (c *compiler) emit(op opcode, operands ...int) int {
+	pc := len(c.proto.Code)
+	if n := len(c.proto.locs); n == 0 || c.proto.locs[n-1].loc != c.loc {
+		c.proto.locs = append(c.proto.locs, codeLoc{pc, c.loc})
+	}
+	c.proto.Code = append(c.proto.Code, byte(op))
+	for i, width := range opOperands[op] {
+		switch width {
+		case 1:
+			c.proto.Code = append(c.proto.Code, byte(operands[i]))
+		case 2:
+			c.proto.Code = append(c.proto.Code, 0, 0)
+			binary.BigEndian.PutUint16(c.proto.Code[len(c.proto.Code)-2:], uint16(operands[i]))
+		}
+	}
+	return pc
+}
+
+// patch sets the target of the jump at pc to the current end of the code.
+func (c *compiler) patch(pc int) error {
+	target := len(c.proto.Code)
+	if target > math.MaxUint16 {
+		return fmt.Errorf("%s: function too large", c.loc.Start)
+	}
+	binary.BigEndian.PutUint16(c.proto.Code[pc+1:], uint16(target))
+	return nil
+}
+
+func (c *compiler) patchAll(pcs []int) error {
+	for _, pc := range pcs {
+		if err := c.patch(pc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) constant(val Value) (int, error) {
+	if len(c.proto.Consts) > math.MaxUint16 {
+		return 0, fmt.Errorf("%s: too many constants", c.loc.Start)
+	}
+	c.proto.Consts = append(c.proto.Consts, val)
+	return len(c.proto.Consts) - 1, nil
+}
+
+func (c *compiler) global(name string) (int, error) {
+	if idx, ok := c.globals[name]; ok {
+		return idx, nil
+	}
+	idx, err := c.constant(StrVal(name))
+	if err != nil {
+		return 0, err
+	}
+	c.globals[name] = idx
+	return idx, nil
+}
+
+func (c *compiler) load(name string, ref varRef) error {
+	switch ref.Kind {
+	case localRef, capturedRef:
+		if ref.Depth > math.MaxUint8 || ref.Slot > math.MaxUint16 {
+			return fmt.Errorf("%s: too many nested lambdas or locals", c.loc.Start)
+		}
+		c.emit(opLoadLocal, ref.Depth, ref.Slot)
+	case globalRef:
+		idx, err := c.global(name)
+		if err != nil {
+			return err
+		}
+		c.emit(opLoadGlobal, idx)
+	case builtinRef:
+		c.emit(opLoadBuiltin, ref.Slot)
+	default:
+		return fmt.Errorf("%s: unresolved name: %s", c.loc.Start, name)
+	}
+	return nil
+}
+
+// store pops the top of the stack into the variable defined by a def or
+// defun.
+func (c *compiler) store(name string, ref varRef) error {
+	if ref.Kind != globalRef {
+		if ref.Slot > math.MaxUint16 {
+			return fmt.Errorf("%s: too many locals", c.loc.Start)
+		}
+		c.emit(opStoreLocal, 0, ref.Slot)
+		return nil
+	}
+	idx, err := c.global(name)
+	if err != nil {
+		return err
+	}
+	c.emit(opDefGlobal, idx)
+	return nil
+}
+
+// bind pops a value into the local bound by pat, or destructures it if pat
+// is not just a name.
+func (c *compiler) bind(pat *pattern) error {
+	if pat.Kind == namePattern {
+		return c.store(pat.Name.Ident, pat.Name.Ref)
+	}
+	if len(c.proto.Patterns) > math.MaxUint16 {
+		return fmt.Errorf("%s: too many patterns", c.loc.Start)
+	}
+	c.proto.Patterns = append(c.proto.Patterns, pat)
+	c.emit(opDestructure, len(c.proto.Patterns)-1)
+	return nil
+}
+
+// fixedArity returns the number of params if they are all required names
+// in the first slots, so that a call can store its arguments directly, or
+// -1 if they must be bound by paramList.bind.
+func fixedArity(params *paramList) int {
+	if len(params.Optional) > 0 || params.Rest != nil || len(params.Key) > 0 {
+		return -1
+	}
+	for i, pat := range params.Required {
+		if pat.Kind != namePattern || pat.Name.Ref.Slot != i {
+			return -1
+		}
+	}
+	return len(params.Required)
+}
+
+// lambda compiles a lambda body to a new prototype and emits a closure over it.
+// The body is preceded by code that sets the optional and keyword params
+// left unbound by the call to their defaults.
+func (c *compiler) lambda(name string, params *paramList, locals []string, body expr) error {
+	proto := &prototype{Name: name, Params: params, Arity: fixedArity(params), Locals: locals}
+	sub := newCompiler(proto)
+	sub.loc = c.loc
+	for _, opt := range params.Defaults() {
+		slot := opt.Name.Ref.Slot
+		skip := sub.emit(opJumpIfBound, 0, slot)
+		if err := sub.alternate(opt.Default, false); err != nil {
+			return err
+		}
+		sub.emit(opStoreLocal, 0, slot)
+		if err := sub.patch(skip); err != nil {
+			return err
+		}
+	}
+	if err := sub.compile(body, true); err != nil {
+		return err
+	}
+	sub.emit(opReturn)
+	if len(c.proto.Protos) > math.MaxUint16 {
+		return fmt.Errorf("%s: too many lambdas", c.loc.Start)
+	}
+	c.proto.Protos = append(c.proto.Protos, proto)
+	c.proto.Captures = true
+	c.emit(opClosure, len(c.proto.Protos)-1)
+	return nil
+}
+
+func (c *compiler) visitCall(e *callExpr) error {
+	tail := c.tail
+	if len(e.Args) > math.MaxUint16 {
+		return fmt.Errorf("%s: too many arguments", e.Span().Start)
+	}
+	if err := c.compile(e.Fn, false); err != nil {
+		return err
+	}
+	for _, arg := range e.Args {
+		if err := c.compile(arg, false); err != nil {
+			return err
+		}
+	}
+	if tail {
+		c.emit(opTailCall, len(e.Args))
+	} else {
+		c.emit(opCall, len(e.Args))
+	}
+	return nil
+}
+
+func (c *compiler) visitFunc(e *funcExpr) error {
+	return c.lambda(e.Name, e.Params, e.Locals, e.Body)
+}
+
+func (c *compiler) visitDef(e *defExpr) error {
+	if err := c.compile(e.Binding, false); err != nil {
+		return err
+	}
+	if err := c.store(e.Name, e.Ref); err != nil {
+		return err
+	}
+	c.emit(opNull)
+	return nil
+}
+
+func (c *compiler) visitDefun(e *defunExpr) error {
+	if err := c.lambda(e.Name, e.Params, e.Locals, e.Body); err != nil {
+		return err
+	}
+	if err := c.store(e.Name, e.Ref); err != nil {
+		return err
+	}
+	c.emit(opNull)
+	return nil
+}
+
+func (c *compiler) visitSet(e *setExpr) error {
+	if err := c.compile(e.Value, false); err != nil {
+		return err
+	}
+	switch ref := e.Name.Ref; ref.Kind {
+	case localRef, capturedRef:
+		if ref.Depth > math.MaxUint8 || ref.Slot > math.MaxUint16 {
+			return fmt.Errorf("%s: too many nested lambdas or locals", c.loc.Start)
+		}
+		c.emit(opSetLocal, ref.Depth, ref.Slot)
+	case globalRef:
+		idx, err := c.global(e.Name.Ident)
+		if err != nil {
+			return err
+		}
+		c.emit(opSetGlobal, idx)
+	default:
+		return fmt.Errorf("%s: unresolved name: %s", c.loc.Start, e.Name.Ident)
+	}
+	c.emit(opNull)
+	return nil
+}
+
+func (c *compiler) visitDefmacro(e *defmacroExpr) error {
+	c.emit(opNull)
+	return nil
+}
+
+func (c *compiler) visitMacro(e *macroExpr) error {
+	return c.compile(e.Expansion, c.tail)
+}
+
+func (c *compiler) visitIf(e *ifExpr) error {
+	tail := c.tail
+	if err := c.compile(e.Antecedent, false); err != nil {
+		return err
+	}
+	jumpAlt := c.emit(opJumpIfFalse, 0)
+	if err := c.compile(e.Consequent, tail); err != nil {
+		return err
+	}
+	jumpEnd := c.emit(opJump, 0)
+	if err := c.patch(jumpAlt); err != nil {
+		return err
+	}
+	if err := c.compile(e.Alternate, tail); err != nil {
+		return err
+	}
+	return c.patch(jumpEnd)
+}
+
+func (c *compiler) visitSeq(e *seqExpr) error {
+	if len(e.Body) == 0 {
+		c.emit(opNull)
+		return nil
+	}
+	last := len(e.Body) - 1
+	for _, expr := range e.Body[:last] {
+		if err := c.compile(expr, false); err != nil {
+			return err
+		}
+		c.emit(opPop)
+	}
+	return c.compile(e.Body[last], c.tail)
+}
+
+// visitLet binds the names in a frame pushed by opEnter. The frame is
+// popped after the body, unless the body is in tail position, in which
+// case it goes away when the enclosing frame returns.
+func (c *compiler) visitLet(e *letExpr) error {
+	tail := c.tail
+	env, err := c.env(e.Locals)
+	if err != nil {
+		return err
+	}
+	if e.Kind == letPlain {
+		for _, init := range e.Inits {
+			if err := c.compile(init, false); err != nil {
+				return err
+			}
+		}
+		c.emit(opEnter, env)
+		for i := len(e.Patterns) - 1; i >= 0; i-- {
+			if err := c.bind(e.Patterns[i]); err != nil {
+				return err
+			}
+		}
+	} else {
+		c.emit(opEnter, env)
+		for i, init := range e.Inits {
+			if err := c.compile(init, false); err != nil {
+				return err
+			}
+			if err := c.bind(e.Patterns[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.compile(e.Body, tail); err != nil {
+		return err
+	}
+	if !tail {
+		c.emit(opLeave)
+	}
+	return nil
+}
+
+// env adds the slot names of a frame pushed by opEnter to the prototype.
+func (c *compiler) env(locals []string) (int, error) {
+	if len(c.proto.Envs) > math.MaxUint16 {
+		return 0, fmt.Errorf("%s: too many let, match and catch forms", c.loc.Start)
+	}
+	c.proto.Envs = append(c.proto.Envs, locals)
+	return len(c.proto.Envs) - 1, nil
+}
+
+func (c *compiler) visitCond(e *condExpr) error {
+	tail := c.tail
+	var ends []int
+	for _, clause := range e.Clauses {
+		if err := c.compile(clause.Test, false); err != nil {
+			return err
+		}
+		next := c.emit(opJumpIfFalse, 0)
+		if err := c.compile(clause.Body, tail); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(opJump, 0))
+		if err := c.patch(next); err != nil {
+			return err
+		}
+	}
+	if err := c.alternate(e.Else, tail); err != nil {
+		return err
+	}
+	return c.patchAll(ends)
+}
+
+func (c *compiler) visitWhen(e *whenExpr) error {
+	tail := c.tail
+	if err := c.compile(e.Test, false); err != nil {
+		return err
+	}
+	jumpAlt := c.emit(opJumpIfFalse, 0)
+	con, alt := e.Body, expr(nil)
+	if e.Unless {
+		con, alt = alt, con
+	}
+	if err := c.alternate(con, tail); err != nil {
+		return err
+	}
+	jumpEnd := c.emit(opJump, 0)
+	if err := c.patch(jumpAlt); err != nil {
+		return err
+	}
+	if err := c.alternate(alt, tail); err != nil {
+		return err
+	}
+	return c.patch(jumpEnd)
+}
+
+func (c *compiler) visitLogic(e *logicExpr) error {
+	if len(e.Args) == 0 {
+		idx, err := c.constant(BoolVal(!e.Or))
+		if err != nil {
+			return err
+		}
+		c.emit(opConst, idx)
+		return nil
+	}
+	tail := c.tail
+	op := opJumpIfFalseOrPop
+	if e.Or {
+		op = opJumpIfTrueOrPop
+	}
+	var ends []int
+	last := len(e.Args) - 1
+	for _, arg := range e.Args[:last] {
+		if err := c.compile(arg, false); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(op, 0))
+	}
+	if err := c.compile(e.Args[last], tail); err != nil {
+		return err
+	}
+	return c.patchAll(ends)
+}
+
+// visitCase keeps the key on the stack while the clauses are tested with
+// opMember, and pops it before running the chosen body.
+func (c *compiler) visitCase(e *caseExpr) error {
+	tail := c.tail
+	if err := c.compile(e.Key, false); err != nil {
+		return err
+	}
+	var ends []int
+	for _, clause := range e.Clauses {
+		idx, err := c.constant(clause.Values)
+		if err != nil {
+			return err
+		}
+		c.emit(opMember, idx)
+		next := c.emit(opJumpIfFalse, 0)
+		c.emit(opPop)
+		if err := c.compile(clause.Body, tail); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(opJump, 0))
+		if err := c.patch(next); err != nil {
+			return err
+		}
+	}
+	c.emit(opPop)
+	if err := c.alternate(e.Else, tail); err != nil {
+		return err
+	}
+	return c.patchAll(ends)
+}
+
+// visitMatch keeps the subject on the stack while the clauses are tried,
+// each in a frame pushed by opEnter, and pops it before running the body
+// of the one that matches. A pattern is matched against a copy of the
+// subject; when it fails, the parts of the subject that it had pushed are
+// popped along with the frame before the next clause is tried.
+func (c *compiler) visitMatch(e *matchExpr) error {
+	tail := c.tail
+	if err := c.compile(e.Subject, false); err != nil {
+		return err
+	}
+	var ends []int
+	for _, clause := range e.Clauses {
+		env, err := c.env(clause.Locals)
+		if err != nil {
+			return err
+		}
+		c.emit(opEnter, env)
+		c.emit(opDup)
+		var fails [][]int
+		if err := c.match(clause.Pattern, 0, &fails); err != nil {
+			return err
+		}
+		c.emit(opPop)
+		if err := c.compile(clause.Body, tail); err != nil {
+			return err
+		}
+		if !tail {
+			c.emit(opLeave)
+		}
+		ends = append(ends, c.emit(opJump, 0))
+		for depth := len(fails) - 1; depth > 0; depth-- {
+			if err := c.patchAll(fails[depth]); err != nil {
+				return err
+			}
+			c.emit(opPop)
+		}
+		if len(fails) > 0 {
+			if err := c.patchAll(fails[0]); err != nil {
+				return err
+			}
+		}
+		c.emit(opLeave)
+	}
+	c.emit(opNoMatch)
+	return c.patchAll(ends)
+}
+
+// match compiles code that pops a value and binds the names in pat to its
+// parts, or jumps if pat does not match it. depth is the number of values
+// below it pushed by the enclosing patterns, which are still on the stack
+// when the jump is taken; the jump is added to fails[depth].
+func (c *compiler) match(pat *pattern, depth int, fails *[][]int) error {
+	fail := func(pc, depth int) {
+		for len(*fails) <= depth {
+			*fails = append(*fails, nil)
+		}
+		(*fails)[depth] = append((*fails)[depth], pc)
+	}
+	switch pat.Kind {
+	case namePattern:
+		return c.store(pat.Name.Ident, pat.Name.Ref)
+	case wildcardPattern:
+		c.emit(opPop)
+	case literalPattern:
+		idx, err := c.constant(pat.Value)
+		if err != nil {
+			return err
+		}
+		fail(c.emit(opMatchConst, 0, idx), depth)
+	case listPattern:
+		n, rest := len(pat.Elems), 0
+		if pat.Rest != nil {
+			rest = 1
+		}
+		if n > math.MaxUint16 {
+			return fmt.Errorf("%s: too many elements in pattern", c.loc.Start)
+		}
+		fail(c.emit(opMatchList, 0, n, rest), depth)
+		for i, elem := range pat.Elems {
+			if err := c.match(elem, depth+n+rest-1-i, fails); err != nil {
+				return err
+			}
+		}
+		if pat.Rest != nil {
+			return c.match(pat.Rest, depth, fails)
+		}
+	case mapPattern:
+		idx, err := c.constant(ListVal(pat.Keys))
+		if err != nil {
+			return err
+		}
+		fail(c.emit(opMatchMap, 0, idx), depth)
+		n := len(pat.Elems)
+		for i, elem := range pat.Elems {
+			if err := c.match(elem, depth+n-1-i, fails); err != nil {
+				return err
+			}
+		}
+	case predPattern:
+		// The predicate is called with a copy of the value, which is left
+		// on the stack for the subpattern.
+		c.emit(opDup)
+		if err := c.compile(pat.Pred, false); err != nil {
+			return err
+		}
+		c.emit(opSwap)
+		c.emit(opCall, 1)
+		fail(c.emit(opJumpIfFalse, 0), depth+1)
+		if len(pat.Elems) == 0 {
+			c.emit(opPop)
+			return nil
+		}
+		return c.match(pat.Elems[0], depth, fails)
+	}
+	return nil
+}
+
+// visitTry compiles the body between opTry and opEndTry, so that an error
+// in it unwinds to the catch clauses with the error pushed. A finally
+// clause is compiled twice: after the body and catch clauses, and in the
+// handler of another try around them, which raises the error again.
+func (c *compiler) visitTry(e *tryExpr) error {
+	var final int
+	if e.Finally != nil {
+		final = c.emit(opTry, 0)
+	}
+	if len(e.Catches) == 0 {
+		if err := c.compile(e.Body, false); err != nil {
+			return err
+		}
+	} else {
+		try := c.emit(opTry, 0)
+		if err := c.compile(e.Body, false); err != nil {
+			return err
+		}
+		c.emit(opEndTry)
+		end := c.emit(opJump, 0)
+		if err := c.patch(try); err != nil {
+			return err
+		}
+		if err := c.catches(e); err != nil {
+			return err
+		}
+		if err := c.patch(end); err != nil {
+			return err
+		}
+	}
+	if e.Finally == nil {
+		return nil
+	}
+	c.emit(opEndTry)
+	if err := c.compile(e.Finally, false); err != nil {
+		return err
+	}
+	c.emit(opPop)
+	end := c.emit(opJump, 0)
+	if err := c.patch(final); err != nil {
+		return err
+	}
+	if err := c.compile(e.Finally, false); err != nil {
+		return err
+	}
+	c.emit(opPop)
+	c.emit(opThrow)
+	return c.patch(end)
+}
+
+// catches compiles the catch clauses of e, which start with the error on
+// the stack. The first clause that accepts it binds it in a frame pushed
+// by opEnter and leaves the value of its body; if none does, the error is
+// raised again.
+func (c *compiler) catches(e *tryExpr) error {
+	var ends []int
+	for _, clause := range e.Catches {
+		next := -1
+		switch {
+		case clause.Kind != 0:
+			next = c.emit(opJumpUnlessKind, 0, int(clause.Kind))
+		case clause.Pred != nil:
+			// The predicate is called with a copy of the error, like the
+			// predicates of a match.
+			c.emit(opDup)
+			if err := c.compile(clause.Pred, false); err != nil {
+				return err
+			}
+			c.emit(opSwap)
+			c.emit(opCall, 1)
+			next = c.emit(opJumpIfFalse, 0)
+		}
+		env, err := c.env(clause.Locals)
+		if err != nil {
+			return err
+		}
+		c.emit(opEnter, env)
+		c.emit(opStoreLocal, 0, clause.Name.Ref.Slot)
+		if err := c.compile(clause.Body, false); err != nil {
+			return err
+		}
+		c.emit(opLeave)
+		ends = append(ends, c.emit(opJump, 0))
+		if next >= 0 {
+			if err := c.patch(next); err != nil {
+				return err
+			}
+		}
+	}
+	c.emit(opThrow)
+	return c.patchAll(ends)
+}
+
+// alternate compiles e, or null if e is nil.
+func (c *compiler) alternate(e expr, tail bool) error {
+	if e == nil {
+		c.emit(opNull)
+		return nil
+	}
+	return c.compile(e, tail)
+}
+
+func (c *compiler) visitQuote(e *quoteExpr) error {
+	idx, err := c.constant(e.Datum)
+	if err != nil {
+		return err
+	}
+	c.emit(opConst, idx)
+	return nil
+}
+
+// visitQuasi collects each run of unspliced elements into a list with
+// opList, and concatenates those lists with the spliced ones using
+// opAppend.
+func (c *compiler) visitQuasi(e *quasiExpr) error {
+	parts, run := 0, 0
+	for i, elem := range e.Elems {
+		if e.Splice[i] && run > 0 {
+			c.emit(opList, run)
+			parts, run = parts+1, 0
+		}
+		if err := c.compile(elem, false); err != nil {
+			return err
+		}
+		if e.Splice[i] {
+			parts++
+		} else {
+			run++
+		}
+	}
+	if run > 0 {
+		c.emit(opList, run)
+		parts++
+	}
+	c.emit(opAppend, parts)
+	return nil
+}
+
+func (c *compiler) visitIdent(e *identExpr) error {
+	if e.Ident == "null" {
+		c.emit(opNull)
+		return nil
+	}
+	return c.load(e.Ident, e.Ref)
+}
+
+func (c *compiler) visitNum(e *numExpr) error {
+	idx, err := c.constant(e.Num)
+	if err != nil {
+		return err
+	}
+	c.emit(opConst, idx)
+	return nil
+}
+
+func (c *compiler) visitBool(e *boolExpr) error {
+	idx, err := c.constant(BoolVal(e.Bool))
+	if err != nil {
+		return err
+	}
+	c.emit(opConst, idx)
+	return nil
+}
+
+func (c *compiler) visitStr(e *strExpr) error {
+	idx, err := c.constant(StrVal(e.Str))
+	if err != nil {
+		return err
+	}
+	c.emit(opConst, idx)
+	return nil
+}
@@ -0,0 +1,186 @@
+package interp
+
+import (
+	"fmt"
+)
+
+// frame holds the locals of a lambda call, in the slots assigned by the
+// resolver. Frames are shared by reference: a lambda keeps a pointer to the
+// frame it was created in, so it sees definitions made in it (or in any
+// enclosing frame) after its creation.
+type frame struct {
+	slots []Value
+	names []string
+	up    *frame
+}
+
+func newFrame(names []string, up *frame) *frame {
+	return &frame{slots: make([]Value, len(names)), names: names, up: up}
+}
+
+// at returns the frame depth levels up from f.
+func (f *frame) at(depth int) *frame {
+	for ; depth > 0; depth-- {
+		f = f.up
+	}
+	return f
+}
+
+// get returns the value in slot, which is undefined until the def that
+// binds it has run.
+func (f *frame) get(slot int) (Value, error) {
+	if val := f.slots[slot]; val != nil {
+		return val, nil
+	}
+	return nil, newError(UndefinedErr, "undefined: %s", f.names[slot])
+}
+
+// set assigns val to slot, which must already be defined.
+func (f *frame) set(slot int, val Value) error {
+	if f.slots[slot] == nil {
+		return newError(UndefinedErr, "undefined: %s", f.names[slot])
+	}
+	f.slots[slot] = val
+	return nil
+}
+
+// arity describes the number of arguments accepted by p, for errors.
+func (p *paramList) arity() string {
+	min, max := len(p.Required), len(p.Required)+len(p.Optional)
+	switch {
+	case p.Rest != nil || len(p.Key) > 0:
+		return fmt.Sprintf("at least %d", min)
+	case min == max:
+		return fmt.Sprintf("%d", min)
+	}
+	return fmt.Sprintf("%d to %d", min, max)
+}
+
+// bind stores the values of the parameters of the lambda fn for a call
+// with args in slots, the slots of its frame. Optional and keyword
+// parameters without an argument are left nil, to be set to their
+// defaults by the caller.
+func (p *paramList) bind(fn string, args []Value, slots []Value) error {
+	min := len(p.Required)
+	variadic := p.Rest != nil || len(p.Key) > 0
+	if len(args) < min || !variadic && len(args) > min+len(p.Optional) {
+		return newError(ArityErr, "bad arity calling %s: got %d, expected %s", fn, len(args), p.arity())
+	}
+	for i, pat := range p.Required {
+		if err := pat.bind(args[i], slots); err != nil {
+			return err
+		}
+	}
+	args = args[min:]
+	for _, opt := range p.Optional {
+		if len(args) > 0 {
+			slots[opt.Name.Ref.Slot], args = args[0], args[1:]
+		}
+	}
+	if p.Rest != nil {
+		if err := p.Rest.bind(append(ListVal{}, args...), slots); err != nil {
+			return err
+		}
+	}
+	if len(p.Key) == 0 {
+		return nil
+	}
+	if len(args)%2 != 0 {
+		return newError(ArityErr, "odd number of keyword arguments calling %s", fn)
+	}
+	for ; len(args) > 0; args = args[2:] {
+		i := p.keyIndex(args[0])
+		if i < 0 {
+			return newError(ArityErr, "unknown keyword argument calling %s: %s", fn, args[0])
+		}
+		if slot := p.Key[i].Name.Ref.Slot; slots[slot] == nil {
+			slots[slot] = args[1]
+		}
+	}
+	return nil
+}
+
+// keyIndex returns the index of the keyword parameter named by the
+// keyword key, or -1 if there is none.
+func (p *paramList) keyIndex(key Value) int {
+	if sym, ok := key.(SymVal); ok {
+		for i, param := range p.Key {
+			if sym.String() == ":"+param.Name.Ident {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// bind destructures val and stores the parts of it in the slots of the
+// names they match.
+func (pat *pattern) bind(val Value, slots []Value) error {
+	switch pat.Kind {
+	case namePattern:
+		slots[pat.Name.Ref.Slot] = val
+	case listPattern:
+		list, ok := val.(ListVal)
+		if !ok {
+			return newError(TypeErr, "can't destructure %s with %s: expected a list, got %s", val, pat, val.Type())
+		}
+		n := len(pat.Elems)
+		if len(list) < n || pat.Rest == nil && len(list) > n {
+			expected := fmt.Sprintf("%d", n)
+			if pat.Rest != nil {
+				expected = fmt.Sprintf("at least %d", n)
+			}
+			return newError(TypeErr, "can't destructure %s with %s: expected %s elements, got %d", list, pat, expected, len(list))
+		}
+		for i, elem := range pat.Elems {
+			if err := elem.bind(list[i], slots); err != nil {
+				return err
+			}
+		}
+		if pat.Rest != nil {
+			return pat.Rest.bind(append(ListVal{}, list[n:]...), slots)
+		}
+	case mapPattern:
+		m, ok := val.(MapVal)
+		if !ok {
+			return newError(TypeErr, "can't destructure %s with %s: expected a map, got %s", val, pat, val.Type())
+		}
+		for i, key := range pat.Keys {
+			elem, ok := m[key]
+			if !ok {
+				return newError(TypeErr, "can't destructure %s with %s: missing key %s", m, pat, key)
+			}
+			if err := pat.Elems[i].bind(elem, slots); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// splitList returns the first n elements of val, which a list pattern with
+// n elements matches, and the rest of them if rest is set. It reports
+// false if val is not a list or has the wrong number of elements.
+func splitList(val Value, n int, rest bool) (ListVal, ListVal, bool) {
+	list, ok := val.(ListVal)
+	if !ok || len(list) < n || !rest && len(list) > n {
+		return nil, nil, false
+	}
+	return list[:n], append(ListVal{}, list[n:]...), true
+}
+
+// mapValues returns the values of val at keys. It reports false if val is
+// not a map or is missing one of keys.
+func mapValues(val Value, keys []Value) ([]Value, bool) {
+	m, ok := val.(MapVal)
+	if !ok {
+		return nil, false
+	}
+	vals := make([]Value, len(keys))
+	for i, key := range keys {
+		if vals[i], ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return vals, true
+}
@@ -0,0 +1,131 @@
+package interp
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden .out files")
+
+// programs returns the example programs, relative to the repository root,
+// which is the parent of this package.
+func programs(t testing.TB) []string {
+	names, err := filepath.Glob("../examples/*.lisp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = append([]string{"../fib.lisp"}, names...)
+	for i, name := range names {
+		names[i] = strings.TrimPrefix(name, "../")
+	}
+	return names
+}
+
+// run runs the program in the named file and returns what it printed,
+// followed by the traceback of the error that stopped it, if any.
+func run(t testing.TB, engine Engine, name string) string {
+	src, err := ioutil.ReadFile(filepath.Join("..", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	in := New(Options{Engine: engine, Stdout: &out})
+	if _, err := in.EvalReader(name, bytes.NewReader(src)); err != nil {
+		if rerr, ok := err.(*RuntimeError); ok {
+			out.WriteString(rerr.Traceback())
+		} else {
+			out.WriteString(err.Error())
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// TestEngines checks the output of each example program under each engine
+// against the golden file next to it. Run with -update to rewrite them.
+func TestEngines(t *testing.T) {
+	for _, name := range programs(t) {
+		golden := filepath.Join("..", strings.TrimSuffix(name, ".lisp")+".out")
+		if *update {
+			got := run(t, TreeEngine, name)
+			if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range engines {
+			t.Run(e.name+"/"+name, func(t *testing.T) {
+				if got := run(t, e.engine, name); got != string(want) {
+					t.Errorf("got:\n%s\nwant:\n%s", got, want)
+				}
+			})
+		}
+	}
+}
+
+// TestManyArgs checks calls with more arguments than fit in a byte.
+func TestManyArgs(t *testing.T) {
+	nums := make([]string, 300)
+	for i := range nums {
+		nums[i] = strconv.Itoa(i)
+	}
+	args := strings.Join(nums, " ")
+	forEachEngine(t, func(t *testing.T, in *Interp, out *bytes.Buffer) {
+		_, err := in.EvalString(`
+			(print (length (list ` + args + `)))
+			(defun count (&rest xs) (length xs))
+			(defun tail () (count ` + args + `))
+			(print (tail))`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != "300\n300\n" {
+			t.Errorf("got output %q, want %q", got, "300\n300\n")
+		}
+		fn, err := in.EvalString("+")
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals := make([]Value, 300)
+		for i := range vals {
+			vals[i] = NumVal(i)
+		}
+		if got, err := in.Call(fn, vals...); err != nil || got != NumVal(44850) {
+			t.Errorf("Call with 300 args: got %v, %v; want 44850", got, err)
+		}
+	})
+}
+
+func BenchmarkFib(b *testing.B) {
+	for _, e := range engines {
+		b.Run(e.name, func(b *testing.B) {
+			in := New(Options{Engine: e.engine})
+			_, err := in.EvalString(`
+				(defun fib (n)
+				  (if (< n 2)
+				    1
+				    (+ (fib (- n 1)) (fib (- n 2)))))`)
+			if err != nil {
+				b.Fatal(err)
+			}
+			fib, err := in.EvalString("fib")
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := in.Call(fib, NumVal(20)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package interp
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ErrorKind int
+
+const (
+	EvalErr ErrorKind = iota + 1
+	UndefinedErr
+	ArityErr
+	TypeErr
+	UserErr
+	MatchErr
+)
+
+// kindNames holds the names of the kinds of error. They head error
+// messages and, written as keywords like :type, select catch clauses.
+var kindNames = map[ErrorKind]string{
+	EvalErr:      "eval",
+	UndefinedErr: "undefined",
+	ArityErr:     "arity",
+	TypeErr:      "type",
+	UserErr:      "user",
+	MatchErr:     "match",
+}
+
+func (kind ErrorKind) String() string {
+	return kindNames[kind]
+}
+
+// Name returns the name of kind as a keyword, like :type.
+func (kind ErrorKind) Name() string {
+	return ":" + kind.String()
+}
+
+// errorKind returns the kind named by the keyword name.
+func errorKind(name string) (ErrorKind, bool) {
+	for kind := range kindNames {
+		if kind.Name() == name {
+			return kind, true
+		}
+	}
+	return 0, false
+}
+
+// CallFrame is an entry in the Lisp-level call stack: a call to the
+// function named Fn made from the expression at Call.
+type CallFrame struct {
+	Fn   string
+	Call Pos
+}
+
+// RuntimeError is returned by the evaluator when a program fails. Loc is
+// the innermost expression that failed and Stack holds the lambda calls
+// that were active at the time, most recent first. Payload is the value
+// given to throw or error, or nil if the interpreter raised the error.
+type RuntimeError struct {
+	Kind    ErrorKind
+	Err     error
+	Loc     Span
+	Stack   []CallFrame
+	Payload Value
+}
+
+func newError(kind ErrorKind, format string, args ...interface{}) *RuntimeError {
+	return &RuntimeError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *RuntimeError) located() bool {
+	return e.Loc.Start.Line > 0
+}
+
+func (e *RuntimeError) Error() string {
+	if !e.located() {
+		return fmt.Sprintf("%s error: %s", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s: %s error: %s", e.Loc.Start, e.Kind, e.Err)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Traceback formats the error followed by the call stack.
+func (e *RuntimeError) Traceback() string {
+	var b strings.Builder
+	b.WriteString(e.Error())
+	for _, frame := range e.Stack {
+		if frame.Call.Line == 0 {
+			fmt.Fprintf(&b, "\n\tin %s (called from Go)", frame.Fn)
+		} else {
+			fmt.Fprintf(&b, "\n\tin %s (called at %s)", frame.Fn, frame.Call)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,617 @@
+package interp
+
+import (
+	"fmt"
+)
+
+type valueStack struct {
+	stack []Value
+}
+
+func (stack *valueStack) pop() Value {
+	if len(stack.stack) == 0 {
+		panic(fmt.Errorf("stack empty"))
+	}
+	end := len(stack.stack) - 1
+	val := stack.stack[end]
+	stack.stack = stack.stack[:end]
+	return val
+}
+
+func (stack *valueStack) push(val Value) {
+	stack.stack = append(stack.stack, val)
+}
+
+// evaluator is a tree-walking interpreter for programs annotated by the
+// resolver. Expressions in tail position (the branches of an if, the last
+// expression of a seq and the body of a called lambda) are not evaluated
+// recursively: the visitor stores them in tail and Eval loops on them, so
+// tail calls run in constant Go stack.
+type evaluator struct {
+	globals map[string]Value
+	env     *frame // nil at the top level
+	stack   valueStack
+	tail    expr
+	calls   []CallFrame
+
+	// defaults holds the params of a lambda that was just called, whose
+	// defaults are evaluated in its frame before its body. This waits until
+	// a tail call has replaced the caller, as it does on the VM.
+	defaults *paramList
+}
+
+func newEvaluator() evaluator {
+	return evaluator{globals: make(map[string]Value)}
+}
+
+// callLambda binds args in a new frame and schedules the body of fn as
+// the tail expression of the current Eval.
+func (ev *evaluator) callLambda(fn lambdaVal, args []Value, site Span) error {
+	// Bind params to values in a frame below the captured one, checking
+	// arity and destructuring patterns
+	env := newFrame(fn.locals, fn.env)
+	if err := fn.params.bind(fn.Name(), args, env.slots); err != nil {
+		return err
+	}
+
+	ev.env = env
+	ev.calls = append(ev.calls, CallFrame{fn.Name(), site.Start})
+	ev.defaults = fn.params
+	ev.tail = fn.body
+	return nil
+}
+
+// bindDefaults sets the optional and keyword params that were not passed
+// to the lambda whose frame is ev.env to their defaults.
+func (ev *evaluator) bindDefaults(params *paramList) error {
+	for _, opt := range params.Defaults() {
+		slot := opt.Name.Ref.Slot
+		if ev.env.slots[slot] != nil {
+			continue
+		}
+		ev.env.slots[slot] = Null
+		if opt.Default == nil {
+			continue
+		}
+		val, err := ev.Eval(opt.Default)
+		if err != nil {
+			return err
+		}
+		ev.env.slots[slot] = val
+	}
+	return nil
+}
+
+func (ev *evaluator) call(fnVal Value, args []Value, site Span) error {
+	switch fn := fnVal.(type) {
+	case NullVal:
+		return newError(TypeErr, "can't call null as function")
+	case BuiltInFuncVal:
+		if err := fn.check(args); err != nil {
+			return err
+		}
+		val, err := fn.f(args...)
+		if err != nil {
+			return err
+		}
+		ev.stack.push(val)
+		return nil
+	case lambdaVal:
+		return ev.callLambda(fn, args, site)
+	default:
+		return newError(TypeErr, "can't call %s as function", fnVal.Type())
+	}
+}
+
+func (ev *evaluator) visitCall(e *callExpr) error {
+	val, err := ev.Eval(e.Fn)
+	if err != nil {
+		return err
+	}
+	var args []Value
+	for _, arg := range e.Args {
+		val, err := ev.Eval(arg)
+		if err != nil {
+			return err
+		}
+		args = append(args, val)
+	}
+	return ev.call(val, args, e.Span())
+}
+
+// setGlobal defines a global variable.
+func (ev *evaluator) setGlobal(name string, val Value) {
+	ev.globals[name] = val
+}
+
+// define binds the value of a def or defun.
+func (ev *evaluator) define(name string, ref varRef, val Value) {
+	if ref.Kind == globalRef {
+		ev.globals[name] = val
+	} else {
+		ev.env.slots[ref.Slot] = val
+	}
+}
+
+func (ev *evaluator) visitDefun(e *defunExpr) error {
+	var fn lambdaVal
+	fn.env = ev.env
+	fn.name = e.Name
+	fn.params = e.Params
+	fn.locals = e.Locals
+	fn.body = e.Body
+	ev.define(e.Name, e.Ref, fn)
+	ev.stack.push(Null)
+	return nil
+}
+
+func (ev *evaluator) visitFunc(e *funcExpr) error {
+	var fn lambdaVal
+	fn.env = ev.env
+	fn.name = e.Name
+	fn.params = e.Params
+	fn.locals = e.Locals
+	fn.body = e.Body
+	ev.stack.push(fn)
+	return nil
+}
+
+func (ev *evaluator) visitDefmacro(e *defmacroExpr) error {
+	ev.stack.push(Null)
+	return nil
+}
+
+func (ev *evaluator) visitMacro(e *macroExpr) error {
+	ev.tail = e.Expansion
+	return nil
+}
+
+func (ev *evaluator) visitDef(e *defExpr) error {
+	val, err := ev.Eval(e.Binding)
+	if err != nil {
+		return err
+	}
+	ev.define(e.Name, e.Ref, val)
+	ev.stack.push(Null)
+	return nil
+}
+
+func (ev *evaluator) visitSet(e *setExpr) error {
+	val, err := ev.Eval(e.Value)
+	if err != nil {
+		return err
+	}
+	switch ref := e.Name.Ref; ref.Kind {
+	case localRef, capturedRef:
+		if err := ev.env.at(ref.Depth).set(ref.Slot, val); err != nil {
+			return err
+		}
+	case globalRef:
+		if _, ok := ev.globals[e.Name.Ident]; !ok {
+			return newError(UndefinedErr, "undefined: %s", e.Name.Ident)
+		}
+		ev.globals[e.Name.Ident] = val
+	default:
+		return newError(EvalErr, "unresolved name: %s", e.Name.Ident)
+	}
+	ev.stack.push(Null)
+	return nil
+}
+
+func (ev *evaluator) visitIf(e *ifExpr) error {
+	antVal, err := ev.Eval(e.Antecedent)
+	if err != nil {
+		return err
+	}
+	if isTrue(antVal) {
+		ev.tail = e.Consequent
+	} else {
+		ev.tail = e.Alternate
+	}
+	return nil
+}
+
+func (ev *evaluator) visitSeq(e *seqExpr) error {
+	if len(e.Body) == 0 {
+		ev.stack.push(Null)
+		return nil
+	}
+	last := len(e.Body) - 1
+	for _, expr := range e.Body[:last] {
+		if _, err := ev.Eval(expr); err != nil {
+			return err
+		}
+	}
+	ev.tail = e.Body[last]
+	return nil
+}
+
+// visitLet binds the names in a new frame and schedules the body as the
+// tail expression, so the frame lasts until the enclosing Eval returns.
+func (ev *evaluator) visitLet(e *letExpr) error {
+	env := newFrame(e.Locals, ev.env)
+	if e.Kind == letPlain {
+		// The inits are evaluated before any of the names are bound, which
+		// happens last to first, the order in which the VM pops them.
+		vals := make([]Value, len(e.Inits))
+		for i, init := range e.Inits {
+			val, err := ev.Eval(init)
+			if err != nil {
+				return err
+			}
+			vals[i] = val
+		}
+		for i := len(vals) - 1; i >= 0; i-- {
+			if err := e.Patterns[i].bind(vals[i], env.slots); err != nil {
+				return err
+			}
+		}
+	} else {
+		ev.env = env
+		for i, init := range e.Inits {
+			val, err := ev.Eval(init)
+			if err != nil {
+				return err
+			}
+			if err := e.Patterns[i].bind(val, env.slots); err != nil {
+				return err
+			}
+		}
+	}
+	ev.env = env
+	ev.tail = e.Body
+	return nil
+}
+
+// test evaluates a condition.
+func (ev *evaluator) test(e expr) (bool, error) {
+	val, err := ev.Eval(e)
+	if err != nil {
+		return false, err
+	}
+	return isTrue(val), nil
+}
+
+func (ev *evaluator) visitCond(e *condExpr) error {
+	for _, clause := range e.Clauses {
+		ok, err := ev.test(clause.Test)
+		if err != nil {
+			return err
+		}
+		if ok {
+			ev.tail = clause.Body
+			return nil
+		}
+	}
+	if e.Else != nil {
+		ev.tail = e.Else
+		return nil
+	}
+	ev.stack.push(Null)
+	return nil
+}
+
+func (ev *evaluator) visitWhen(e *whenExpr) error {
+	ok, err := ev.test(e.Test)
+	if err != nil {
+		return err
+	}
+	if ok != e.Unless {
+		ev.tail = e.Body
+		return nil
+	}
+	ev.stack.push(Null)
+	return nil
+}
+
+func (ev *evaluator) visitLogic(e *logicExpr) error {
+	if len(e.Args) == 0 {
+		ev.stack.push(BoolVal(!e.Or))
+		return nil
+	}
+	last := len(e.Args) - 1
+	for _, arg := range e.Args[:last] {
+		val, err := ev.Eval(arg)
+		if err != nil {
+			return err
+		}
+		if isTrue(val) == e.Or {
+			ev.stack.push(val)
+			return nil
+		}
+	}
+	ev.tail = e.Args[last]
+	return nil
+}
+
+func (ev *evaluator) visitCase(e *caseExpr) error {
+	key, err := ev.Eval(e.Key)
+	if err != nil {
+		return err
+	}
+	for _, clause := range e.Clauses {
+		for _, val := range clause.Values {
+			if eqv(key, val) {
+				ev.tail = clause.Body
+				return nil
+			}
+		}
+	}
+	if e.Else != nil {
+		ev.tail = e.Else
+		return nil
+	}
+	ev.stack.push(Null)
+	return nil
+}
+
+// visitMatch binds the names in the pattern of each clause in a new frame
+// until one matches, and schedules its body as the tail expression.
+func (ev *evaluator) visitMatch(e *matchExpr) error {
+	subject, err := ev.Eval(e.Subject)
+	if err != nil {
+		return err
+	}
+	outer := ev.env
+	for _, clause := range e.Clauses {
+		ev.env = newFrame(clause.Locals, outer)
+		ok, err := ev.match(clause.Pattern, subject, e.Span())
+		if err != nil {
+			return err
+		}
+		if ok {
+			ev.tail = clause.Body
+			return nil
+		}
+	}
+	ev.env = outer
+	return newError(MatchErr, "no match for %s", subject)
+}
+
+// match reports whether pat matches val, binding the names in it in
+// ev.env. Predicates are called as if from site.
+func (ev *evaluator) match(pat *pattern, val Value, site Span) (bool, error) {
+	switch pat.Kind {
+	case namePattern:
+		ev.env.slots[pat.Name.Ref.Slot] = val
+	case literalPattern:
+		return eqv(pat.Value, val), nil
+	case listPattern:
+		elems, rest, ok := splitList(val, len(pat.Elems), pat.Rest != nil)
+		if !ok {
+			return false, nil
+		}
+		for i, elem := range pat.Elems {
+			if ok, err := ev.match(elem, elems[i], site); !ok || err != nil {
+				return false, err
+			}
+		}
+		if pat.Rest != nil {
+			return ev.match(pat.Rest, rest, site)
+		}
+	case mapPattern:
+		vals, ok := mapValues(val, pat.Keys)
+		if !ok {
+			return false, nil
+		}
+		for i, elem := range pat.Elems {
+			if ok, err := ev.match(elem, vals[i], site); !ok || err != nil {
+				return false, err
+			}
+		}
+	case predPattern:
+		fn, err := ev.Eval(pat.Pred)
+		if err != nil {
+			return false, err
+		}
+		res, err := ev.apply(fn, []Value{val}, site)
+		if err != nil || !isTrue(res) {
+			return false, err
+		}
+		if len(pat.Elems) > 0 {
+			return ev.match(pat.Elems[0], val, site)
+		}
+	}
+	return true, nil
+}
+
+// visitTry evaluates the body, and the catch clauses if it fails, before
+// the finally clause, so none of them are in tail position.
+func (ev *evaluator) visitTry(e *tryExpr) error {
+	val, err := ev.Eval(e.Body)
+	if rerr, ok := err.(*RuntimeError); ok && len(e.Catches) > 0 {
+		val, err = ev.catch(e, ErrorVal{rerr})
+	}
+	if e.Finally != nil {
+		if _, err := ev.Eval(e.Finally); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	ev.stack.push(val)
+	return nil
+}
+
+// catch runs the first catch clause of e that accepts the error, or
+// returns the error if none does.
+func (ev *evaluator) catch(e *tryExpr, errVal ErrorVal) (Value, error) {
+	for _, clause := range e.Catches {
+		switch {
+		case clause.Kind != 0:
+			if errVal.Kind() != clause.Kind {
+				continue
+			}
+		case clause.Pred != nil:
+			pred, err := ev.Eval(clause.Pred)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := ev.apply(pred, []Value{errVal}, e.Span())
+			if err != nil {
+				return nil, err
+			}
+			if !isTrue(ok) {
+				continue
+			}
+		}
+		outer := ev.env
+		ev.env = newFrame(clause.Locals, outer)
+		ev.env.slots[clause.Name.Ref.Slot] = errVal
+		val, err := ev.Eval(clause.Body)
+		ev.env = outer
+		return val, err
+	}
+	return nil, errVal.err
+}
+
+func (ev *evaluator) visitQuote(e *quoteExpr) error {
+	ev.stack.push(e.Datum)
+	return nil
+}
+
+func (ev *evaluator) visitQuasi(e *quasiExpr) error {
+	var parts []Value
+	for i, elem := range e.Elems {
+		val, err := ev.Eval(elem)
+		if err != nil {
+			return err
+		}
+		if !e.Splice[i] {
+			val = ListVal{val}
+		}
+		parts = append(parts, val)
+	}
+	list, err := appendLists(parts)
+	if err != nil {
+		return err
+	}
+	ev.stack.push(list)
+	return nil
+}
+
+func (ev *evaluator) visitIdent(e *identExpr) error {
+	if e.Ident == "null" {
+		ev.stack.push(Null)
+		return nil
+	}
+	var val Value
+	switch e.Ref.Kind {
+	case localRef, capturedRef:
+		v, err := ev.env.at(e.Ref.Depth).get(e.Ref.Slot)
+		if err != nil {
+			return err
+		}
+		val = v
+	case globalRef:
+		v, ok := ev.globals[e.Ident]
+		if !ok {
+			return newError(UndefinedErr, "undefined: %s", e.Ident)
+		}
+		val = v
+	case builtinRef:
+		val = builtinTable[e.Ref.Slot]
+	default:
+		return newError(EvalErr, "unresolved name: %s", e.Ident)
+	}
+	ev.stack.push(val)
+	return nil
+}
+
+func (ev *evaluator) visitNum(e *numExpr) error {
+	ev.stack.push(e.Num)
+	return nil
+}
+
+func (ev *evaluator) visitBool(e *boolExpr) error {
+	ev.stack.push(BoolVal(e.Bool))
+	return nil
+}
+
+func (ev *evaluator) visitStr(e *strExpr) error {
+	ev.stack.push(StrVal(e.Str))
+	return nil
+}
+
+// callStack returns the active lambda calls, most recent first. Calls
+// that were replaced by a tail call are not included.
+func (ev *evaluator) callStack() []CallFrame {
+	var stack []CallFrame
+	for i := len(ev.calls) - 1; i >= 0; i-- {
+		stack = append(stack, ev.calls[i])
+	}
+	return stack
+}
+
+// locate turns err into a *RuntimeError positioned at loc, unless an
+// expression nested inside the one at loc has already done so.
+func (ev *evaluator) locate(err error, loc Span) *RuntimeError {
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		rerr = &RuntimeError{Kind: EvalErr, Err: err}
+	}
+	if !rerr.located() {
+		rerr.Loc = loc
+		rerr.Stack = ev.callStack()
+	}
+	return rerr
+}
+
+// Eval evaluates a resolved expression and returns its value.
+func (ev *evaluator) Eval(e expr) (Value, error) {
+	return ev.eval(e, ev.env, len(ev.calls))
+}
+
+// Call calls fn with args. It may be used while a program is running, for
+// example by a builtin that takes a function.
+func (ev *evaluator) Call(fn Value, args ...Value) (Value, error) {
+	val, err := ev.apply(fn, args, Span{})
+	if err != nil {
+		return nil, ev.locate(err, Span{})
+	}
+	return val, nil
+}
+
+// apply calls fn with args from a call at site and returns its value.
+// Errors from the call itself, such as a bad arity, are not located.
+func (ev *evaluator) apply(fn Value, args []Value, site Span) (Value, error) {
+	env, depth := ev.env, len(ev.calls)
+	if err := ev.call(fn, args, site); err != nil {
+		return nil, err
+	}
+	if ev.tail == nil {
+		return ev.stack.pop(), nil
+	}
+	body := ev.tail
+	ev.tail = nil
+	return ev.eval(body, env, depth)
+}
+
+// eval evaluates e, then restores the frame to env and the call stack to
+// depth, since tail calls made while evaluating e replace them.
+func (ev *evaluator) eval(e expr, env *frame, depth int) (Value, error) {
+	defer func() {
+		ev.env, ev.calls, ev.tail, ev.defaults = env, ev.calls[:depth], nil, nil
+	}()
+	for {
+		if params := ev.defaults; params != nil {
+			ev.defaults = nil
+			if err := ev.bindDefaults(params); err != nil {
+				return nil, ev.locate(err, e.Span())
+			}
+		}
+		if err := e.visit(ev); err != nil {
+			return nil, ev.locate(err, e.Span())
+		}
+		if ev.tail == nil {
+			return ev.stack.pop(), nil
+		}
+		e, ev.tail = ev.tail, nil
+		// A tail call replaces the frame of the lambda it was made from.
+		if n := len(ev.calls); n > depth+1 {
+			ev.calls[n-2] = ev.calls[n-1]
+			ev.calls = ev.calls[:n-1]
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Engine selects how an Interp runs programs.
+type Engine int
+
+const (
+	// TreeEngine walks the syntax tree. It is the default.
+	TreeEngine Engine = iota
+	// VMEngine compiles each expression to bytecode and runs it on the VM.
+	VMEngine
+)
+
+// Options configures an Interp. The zero value is a tree-walking
+// interpreter that prints to os.Stdout.
+type Options struct {
+	Engine Engine
+	// Stdout is where print writes. It defaults to os.Stdout.
+	Stdout io.Writer
+	// If Disasm is set, the bytecode of each top-level expression is
+	// written to it before the expression is run.
+	Disasm io.Writer
+	// If AllowUndefined is set, references to names that have not been
+	// defined yet are reported when they are evaluated rather than before
+	// the program runs. A REPL needs this, since functions are entered
+	// one at a time.
+	AllowUndefined bool
+}
+
+// engine runs resolved expressions.
+type engine interface {
+	Eval(e expr) (Value, error)
+	Call(fn Value, args ...Value) (Value, error)
+	setGlobal(name string, val Value)
+}
+
+// Interp is an interpreter session. Definitions made by one call to Eval
+// are visible to later ones.
+type Interp struct {
+	opts     Options
+	resolver resolver
+	engine   engine
+	macros   map[string]Value // transformers of the macros defined so far
+}
+
+// New returns an interpreter configured by opts. The zero Options select
+// the tree engine and print to os.Stdout. Besides the builtins, print,
+// macroexpand and macroexpand-1 are predefined as globals, since they need
+// the Interp's output and macros.
+func New(opts Options) *Interp {
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	in := &Interp{opts: opts, resolver: newResolver(), macros: make(map[string]Value)}
+	in.resolver.AllowUndefined = opts.AllowUndefined
+	switch opts.Engine {
+	case VMEngine:
+		vm := newMachine()
+		in.engine = &vm
+	default:
+		ev := newEvaluator()
+		in.engine = &ev
+	}
+	in.Define("print", NewBuiltin("print", []ValType{AnyT}, func(args ...Value) (Value, error) {
+		fmt.Fprintln(in.opts.Stdout, args[0])
+		return Null, nil
+	}))
+	in.Define("macroexpand-1", NewBuiltin("macroexpand-1", []ValType{AnyT}, func(args ...Value) (Value, error) {
+		val, _, err := in.macroexpand1(args[0])
+		return val, err
+	}))
+	in.Define("macroexpand", NewBuiltin("macroexpand", []ValType{AnyT}, func(args ...Value) (Value, error) {
+		return in.macroexpand(args[0])
+	}))
+	return in
+}
+
+// Define binds a global variable, which is visible to programs evaluated
+// afterwards.
+func (in *Interp) Define(name string, val Value) {
+	in.resolver.declareGlobal(name)
+	in.engine.setGlobal(name, val)
+}
+
+// DefineFunc wraps a Go function with GoFunc and binds it to a global
+// variable.
+func (in *Interp) DefineFunc(name string, fn interface{}) error {
+	f, err := GoFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	in.Define(name, f)
+	return nil
+}
+
+// Call calls a function value, such as one returned by a program.
+func (in *Interp) Call(fn Value, args ...Value) (Value, error) {
+	return in.engine.Call(fn, args...)
+}
+
+// EvalString evaluates a program and returns the value of its last
+// expression.
+func (in *Interp) EvalString(src string) (Value, error) {
+	return in.EvalReader("<string>", strings.NewReader(src))
+}
+
+// newParser returns a parser for a program to be evaluated by in, which
+// reads calls to the macros defined so far as data.
+func (in *Interp) newParser(name string, r io.Reader) parser {
+	p := newParser(newLexer(name, bufio.NewReader(r)))
+	for name := range in.macros {
+		p.macros[name] = true
+	}
+	return p
+}
+
+// EvalReader evaluates the program read from r and returns the value of its
+// last expression. The whole program is parsed before any of it is run.
+// name is used to report positions.
+func (in *Interp) EvalReader(name string, r io.Reader) (Value, error) {
+	var result Value = Null
+	if err := in.EvalEach(name, r, func(val Value) { result = val }); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// EvalEach evaluates the program read from r like EvalReader, but calls f
+// with the value of each top-level expression as soon as it is evaluated.
+func (in *Interp) EvalEach(name string, r io.Reader, f func(Value)) error {
+	p := in.newParser(name, r)
+	var exprs []expr
+	static := -1
+	for {
+		expr, err := p.Parse()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if static < 0 && p.defmacros > 0 {
+			static = len(exprs)
+		}
+		exprs = append(exprs, expr)
+	}
+	if static < 0 {
+		static = len(exprs)
+	}
+	return in.evalAll(exprs, static, f)
+}
+
+// evalAll evaluates parsed top-level expressions in order, calling f with
+// the value of each. The globals that the expressions define are declared
+// first, so functions may refer to ones defined after them. The first
+// static expressions are expanded and resolved before any is run, so that
+// an error in them is reported before the program has any effect. The
+// rest, which start with the first to contain a defmacro, are each expanded
+// and resolved just before being run, so macros may call the functions
+// defined before them.
+func (in *Interp) evalAll(exprs []expr, static int, f func(Value)) error {
+	in.resolver.declareDefined(exprs...)
+	for _, e := range exprs[:static] {
+		if err := in.check(e); err != nil {
+			return err
+		}
+	}
+	for i, e := range exprs {
+		if i >= static {
+			if err := in.check(e); err != nil {
+				return err
+			}
+		}
+		val, err := in.run(e)
+		if err != nil {
+			return err
+		}
+		f(val)
+	}
+	return nil
+}
+
+// check expands and resolves a single top-level expression.
+func (in *Interp) check(e expr) error {
+	x := expander{in: in}
+	if err := x.expand(e); err != nil {
+		return err
+	}
+	return in.resolver.resolve(e)
+}
+
+// run runs a single top-level expression that has been checked.
+func (in *Interp) run(e expr) (Value, error) {
+	if in.opts.Disasm != nil {
+		proto, err := compile(e)
+		if err != nil {
+			return nil, err
+		}
+		disassemble(in.opts.Disasm, proto)
+	}
+	return in.engine.Eval(e)
+}
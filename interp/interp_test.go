@@ -0,0 +1,77 @@
+package interp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var engines = []struct {
+	name   string
+	engine Engine
+}{
+	{"tree", TreeEngine},
+	{"vm", VMEngine},
+}
+
+// forEachEngine runs f with a new Interp for each engine, printing to out.
+func forEachEngine(t *testing.T, f func(t *testing.T, in *Interp, out *bytes.Buffer)) {
+	for _, e := range engines {
+		t.Run(e.name, func(t *testing.T) {
+			var out bytes.Buffer
+			f(t, New(Options{Engine: e.engine, Stdout: &out}), &out)
+		})
+	}
+}
+
+// evalTests are programs and the values they evaluate to.
+type evalTests []struct {
+	src  string
+	want string
+}
+
+func (tests evalTests) run(t *testing.T, in *Interp) {
+	t.Helper()
+	for _, tc := range tests {
+		val, err := in.EvalString(tc.src)
+		if err != nil {
+			t.Errorf("%s: %s", tc.src, err)
+			continue
+		}
+		if got := val.String(); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestStaticErrorsBeforeRunning(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, out *bytes.Buffer) {
+		for _, tc := range []struct {
+			src  string
+			want string
+		}{
+			{`(print "side effect") (undefined-name)`, "undefined: undefined-name"},
+			{`(print "side effect") (defun f (x x) x)`, "duplicate parameter: x"},
+			{`(print "side effect") (seq (print "more") (if))`, "failed to parse if"},
+		} {
+			out.Reset()
+			_, err := in.EvalString(tc.src)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("%s: got error %v, want %q", tc.src, err, tc.want)
+			}
+			if out.Len() != 0 {
+				t.Errorf("%s: printed %q before failing", tc.src, out.String())
+			}
+		}
+		// The forms after a defmacro may call it, so they are checked only
+		// once the forms before them have run.
+		out.Reset()
+		_, err := in.EvalString(`(print 1) (defmacro m () '(undefined-name)) (print 2) (m)`)
+		if err == nil || !strings.Contains(err.Error(), "undefined: undefined-name") {
+			t.Errorf("got error %v, want undefined-name", err)
+		}
+		if got := out.String(); got != "1\n2\n" {
+			t.Errorf("got output %q, want %q", got, "1\n2\n")
+		}
+	})
+}
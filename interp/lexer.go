@@ -0,0 +1,393 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+type tokType int
+
+const (
+	tokLParen tokType = iota + 1
+	tokRParen
+	tokIdent
+	tokKeyword
+	tokNum
+	tokStr
+	tokNull
+	tokQuote
+	tokQuasiquote
+	tokUnquote
+	tokSplice
+	tokBool
+	tokEOF
+)
+
+func (typ tokType) String() string {
+	switch typ {
+	case tokLParen:
+		return "LPAREN"
+	case tokRParen:
+		return "RPAREN"
+	case tokIdent:
+		return "IDENT"
+	case tokKeyword:
+		return "KEYWORD"
+	case tokNum:
+		return "NUM"
+	case tokStr:
+		return "STR"
+	case tokNull:
+		return "NULL"
+	case tokQuote:
+		return "QUOTE"
+	case tokQuasiquote:
+		return "QUASIQUOTE"
+	case tokUnquote:
+		return "UNQUOTE"
+	case tokSplice:
+		return "SPLICE"
+	case tokBool:
+		return "BOOL"
+	case tokEOF:
+		return "EOF"
+	}
+	return ""
+}
+
+var keywords = [...]string{
+	"fn",
+	"def",
+	"defun",
+	"set!",
+	"defmacro",
+	"if",
+	"seq",
+	"let",
+	"let*",
+	"letrec",
+	"cond",
+	"else",
+	"when",
+	"unless",
+	"and",
+	"or",
+	"case",
+	"match",
+	"try",
+	"catch",
+	"finally",
+	"quote",
+}
+
+func isKeyword(s string) bool {
+	for _, kw := range keywords {
+		if kw == s {
+			return true
+		}
+	}
+	return false
+}
+
+type token struct {
+	Typ tokType
+	Lit string
+	Loc Span
+}
+
+var emptyToken = token{Typ: tokEOF}
+
+func (t token) String() string {
+	return fmt.Sprintf("{%s, %s}", t.Typ, t.Lit)
+}
+
+type lexer struct {
+	b    *bufio.Reader
+	pos  Pos // position of the next rune to be read
+	prev Pos // position of the last rune read, restored by unreadRune
+	cur  token
+	err  error
+}
+
+// newLexer returns a lexer reading from b. The file name is only used to
+// report positions.
+func newLexer(file string, b *bufio.Reader) lexer {
+	l := lexer{b: b, pos: Pos{File: file, Line: 1, Col: 1}}
+	l.advance()
+	return l
+}
+
+func (l *lexer) readRune() (rune, error) {
+	r, size, err := l.b.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	l.prev = l.pos
+	l.pos.Offset += size
+	if r == '\n' {
+		l.pos.Line++
+		l.pos.Col = 1
+	} else {
+		l.pos.Col++
+	}
+	return r, nil
+}
+
+func (l *lexer) unreadRune() {
+	l.b.UnreadRune()
+	l.pos = l.prev
+}
+
+func (l *lexer) nextChar() (rune, error) {
+	inComment := false
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			return 0, err
+		}
+		switch r {
+		case ' ':
+			continue
+		case '\t':
+			continue
+		case '\n':
+			inComment = false
+			continue
+		case ';':
+			inComment = true
+			continue
+		}
+		if inComment {
+			continue
+		}
+		return r, nil
+	}
+}
+
+func isSep(r rune) bool {
+	return strings.ContainsRune(") \n", r)
+}
+
+func (l *lexer) readWhile(first rune, pred func(rune) bool, typ tokType) (string, error) {
+	lit := []rune{first}
+	for {
+		r, err := l.readRune()
+		if err == io.EOF {
+			return string(lit), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if isSep(r) {
+			l.unreadRune()
+			return string(lit), nil
+		}
+		if !pred(r) {
+			return "", fmt.Errorf("expected %s, got %c", typ, r)
+		}
+		lit = append(lit, r)
+	}
+}
+
+// isSymbolStart reports whether an identifier may start with r: a letter
+// or one of the conventional Lisp symbol characters. Identifiers that
+// look like numbers, such as -5 or .5, are scanned as numbers instead.
+func isSymbolStart(r rune) bool {
+	return unicode.IsLetter(r) || strings.ContainsRune(`-+?!*/<>=_%&.:`, r)
+}
+
+// isSymbolChar reports whether r may appear in an identifier after the
+// first character, which allows digits as well.
+func isSymbolChar(r rune) bool {
+	return isSymbolStart(r) || unicode.IsDigit(r)
+}
+
+func (l *lexer) ident(first rune) (string, error) {
+	lit, err := l.readWhile(first, isSymbolChar, tokIdent)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan ident: %w", err)
+	}
+	return lit, nil
+}
+
+// num scans an integer, a fraction like 1/3 or a float like 1.5e-3. The
+// literal is only checked when it is parsed.
+func (l *lexer) num(first rune) (string, error) {
+	prev := first
+	isNumChar := func(r rune) bool {
+		ok := unicode.IsDigit(r) || strings.ContainsRune(".eE/", r) ||
+			(r == '+' || r == '-') && (prev == 'e' || prev == 'E')
+		prev = r
+		return ok
+	}
+	lit, err := l.readWhile(first, isNumChar, tokNum)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan num: %w", err)
+	}
+	return lit, nil
+}
+
+// escapes maps the characters that may follow a backslash in a string
+// literal to the characters they stand for. \uXXXX is handled separately.
+var escapes = map[rune]rune{
+	'"':  '"',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+}
+
+// str scans a string literal whose opening quote has been read, and
+// returns its contents with escapes decoded.
+func (l *lexer) str() (string, error) {
+	var lit []rune
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			return "", fmt.Errorf("failed to scan str: %w", err)
+		}
+		switch r {
+		case '"':
+			return string(lit), nil
+		case '\\':
+			if r, err = l.escape(); err != nil {
+				return "", fmt.Errorf("failed to scan str: %w", err)
+			}
+		}
+		lit = append(lit, r)
+	}
+}
+
+// escape scans the rest of an escape sequence after the backslash.
+func (l *lexer) escape() (rune, error) {
+	r, err := l.readRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != 'u' {
+		if esc, ok := escapes[r]; ok {
+			return esc, nil
+		}
+		return 0, fmt.Errorf("unknown escape: \\%c", r)
+	}
+	var code rune
+	for i := 0; i < 4; i++ {
+		d, err := l.readRune()
+		if err != nil {
+			return 0, err
+		}
+		n := strings.IndexRune("0123456789abcdef", unicode.ToLower(d))
+		if n < 0 {
+			return 0, fmt.Errorf("bad \\u escape: expected hex digit, got %c", d)
+		}
+		code = code*16 + rune(n)
+	}
+	return code, nil
+}
+
+// numberNext reports whether the runes after r continue a number, without
+// consuming them: r is followed by a digit or, if r is a sign, by a "."
+// and a digit, as in -.5.
+func (l *lexer) numberNext(r rune) bool {
+	next, _ := l.b.Peek(2)
+	switch {
+	case len(next) > 0 && unicode.IsDigit(rune(next[0])):
+		return true
+	case r != '.' && len(next) > 1 && next[0] == '.':
+		return unicode.IsDigit(rune(next[1]))
+	}
+	return false
+}
+
+// advance scans the next token into l.cur. On failure l.err is set and
+// l.cur is an EOF token positioned where the bad token starts.
+func (l *lexer) advance() {
+	r, err := l.nextChar()
+	if err != nil {
+		l.cur, l.err = l.token(tokEOF, "", l.pos), err
+		return
+	}
+	start := l.prev
+	l.cur, l.err = l.token(tokEOF, "", start), nil
+
+	switch {
+	case r == '\'':
+		l.cur = l.token(tokQuote, `'`, start)
+	case r == '`':
+		l.cur = l.token(tokQuasiquote, "`", start)
+	case r == ',':
+		if next, err := l.readRune(); err == nil && next == '@' {
+			l.cur = l.token(tokSplice, ",@", start)
+			return
+		} else if err == nil {
+			l.unreadRune()
+		}
+		l.cur = l.token(tokUnquote, ",", start)
+	case r == '"':
+		lit, err := l.str()
+		if err != nil {
+			l.err = err
+			return
+		}
+		l.cur = l.token(tokStr, lit, start)
+	case r == '#':
+		lit, err := l.readWhile(r, unicode.IsLetter, tokBool)
+		if err != nil {
+			l.err = fmt.Errorf("failed to scan bool: %w", err)
+			return
+		}
+		switch lit {
+		case "#t":
+			l.cur = l.token(tokBool, "true", start)
+		case "#f":
+			l.cur = l.token(tokBool, "false", start)
+		default:
+			l.err = fmt.Errorf("failed to scan bool: expected #t or #f, got %s", lit)
+		}
+	case r == '(':
+		l.cur = l.token(tokLParen, `(`, start)
+	case r == ')':
+		l.cur = l.token(tokRParen, `)`, start)
+	case unicode.IsDigit(r) || strings.ContainsRune("+-.", r) && l.numberNext(r):
+		lit, err := l.num(r)
+		if err != nil {
+			l.err = err
+			return
+		}
+		l.cur = l.token(tokNum, lit, start)
+	case isSymbolStart(r):
+		lit, err := l.ident(r)
+		if err != nil {
+			l.err = err
+			return
+		}
+		if isKeyword(lit) {
+			l.cur = l.token(tokKeyword, lit, start)
+		} else if lit == "true" || lit == "false" {
+			l.cur = l.token(tokBool, lit, start)
+		} else {
+			l.cur = l.token(tokIdent, lit, start)
+		}
+	default:
+		l.err = fmt.Errorf("failed to scan: unknown token: %c", r)
+	}
+}
+
+// token makes a token of the given type that starts at start and ends at
+// the current position.
+func (l *lexer) token(typ tokType, lit string, start Pos) token {
+	return token{Typ: typ, Lit: lit, Loc: Span{start, l.pos}}
+}
+
+func (l *lexer) Peek() (token, error) {
+	return l.cur, l.err
+}
+
+func (l *lexer) Next() (token, error) {
+	tok, err := l.cur, l.err
+	l.advance()
+	return tok, err
+}
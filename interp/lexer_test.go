@@ -0,0 +1,79 @@
+package interp
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func lexAll(t *testing.T, src string) []token {
+	t.Helper()
+	l := newLexer("test", bufio.NewReader(strings.NewReader(src)))
+	var toks []token
+	for {
+		tok, err := l.Next()
+		if err == io.EOF {
+			return toks
+		}
+		if err != nil {
+			t.Fatalf("lexing %q: %s", src, err)
+		}
+		toks = append(toks, tok)
+	}
+}
+
+func TestLexSignedNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want Value
+	}{
+		{"5", NumVal(5)},
+		{"+5", NumVal(5)},
+		{"-5", NumVal(-5)},
+		{"1.5", FloatVal(1.5)},
+		{"+1.5", FloatVal(1.5)},
+		{"-1.5", FloatVal(-1.5)},
+		{".5", FloatVal(0.5)},
+		{"+.5", FloatVal(0.5)},
+		{"-.5", FloatVal(-0.5)},
+		{"-1e3", FloatVal(-1000)},
+		{"-2.5e-1", FloatVal(-0.25)},
+		{"1/3", mustNum(t, "1/3")},
+		{"+1/3", mustNum(t, "1/3")},
+		{"-1/3", mustNum(t, "-1/3")},
+		{"-4/2", NumVal(-2)},
+	} {
+		toks := lexAll(t, tc.src)
+		if len(toks) != 1 || toks[0].Typ != tokNum || toks[0].Lit != tc.src {
+			t.Errorf("%q: got tokens %v, want one NUM", tc.src, toks)
+			continue
+		}
+		got, err := parseNum(toks[0].Lit)
+		if err != nil {
+			t.Errorf("%q: %s", tc.src, err)
+			continue
+		}
+		if got.Type() != tc.want.Type() || got.String() != tc.want.String() {
+			t.Errorf("%q: got %v, want %v", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestLexSignsAsIdents(t *testing.T) {
+	for _, src := range []string{"+", "-", ".", "-.", "+.x", "-a", "..5"} {
+		toks := lexAll(t, src)
+		if len(toks) != 1 || toks[0].Typ != tokIdent || toks[0].Lit != src {
+			t.Errorf("%q: got tokens %v, want one IDENT", src, toks)
+		}
+	}
+}
+
+func mustNum(t *testing.T, lit string) Value {
+	t.Helper()
+	v, err := parseNum(lit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
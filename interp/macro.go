@@ -0,0 +1,362 @@
+package interp
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxExpansionDepth limits how deeply macro expansions may nest, so that a
+// macro that expands to a call to itself is reported instead of looping.
+const maxExpansionDepth = 1000
+
+// dataLexer produces the tokens that a datum would be read from, so that
+// the code returned by a macro can be parsed like source. Every token is
+// positioned at the macro call.
+type dataLexer struct {
+	toks []token
+	loc  Span
+}
+
+// prefixLits holds the source text of the tokens in prefixes.
+var prefixLits = map[tokType]string{
+	tokQuote:      "'",
+	tokQuasiquote: "`",
+	tokUnquote:    ",",
+	tokSplice:     ",@",
+}
+
+func newDataLexer(datum Value, loc Span) (*dataLexer, error) {
+	l := &dataLexer{loc: loc}
+	if err := l.write(datum); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *dataLexer) token(typ tokType, lit string) {
+	l.toks = append(l.toks, token{Typ: typ, Lit: lit, Loc: l.loc})
+}
+
+// write appends the tokens for datum. Lists of the form (quasiquote x),
+// (unquote x) and (unquote-splicing x) are written with their prefix
+// tokens, since the parser only reads templates in that form.
+func (l *dataLexer) write(datum Value) error {
+	switch val := datum.(type) {
+	case ListVal:
+		if len(val) == 2 {
+			if sym, ok := val[0].(SymVal); ok {
+				for typ, name := range prefixes {
+					if sym.String() == name {
+						l.token(typ, prefixLits[typ])
+						return l.write(val[1])
+					}
+				}
+			}
+		}
+		l.token(tokLParen, "(")
+		for _, elem := range val {
+			if err := l.write(elem); err != nil {
+				return err
+			}
+		}
+		l.token(tokRParen, ")")
+	case SymVal:
+		if isKeyword(val.String()) {
+			l.token(tokKeyword, val.String())
+		} else {
+			l.token(tokIdent, val.String())
+		}
+	case NullVal:
+		l.token(tokIdent, "null")
+	case BoolVal:
+		l.token(tokBool, val.String())
+	case StrVal:
+		l.token(tokStr, string(val))
+	default:
+		if val.Type() != NumT {
+			return fmt.Errorf("can't use %s as code", val.Type())
+		}
+		l.token(tokNum, val.String())
+	}
+	return nil
+}
+
+func (l *dataLexer) Peek() (token, error) {
+	if len(l.toks) == 0 {
+		return token{Typ: tokEOF, Loc: l.loc}, io.EOF
+	}
+	return l.toks[0], nil
+}
+
+func (l *dataLexer) Next() (token, error) {
+	tok, err := l.Peek()
+	if err == nil {
+		l.toks = l.toks[1:]
+	}
+	return tok, err
+}
+
+// parseData parses the code returned by a macro called at loc.
+func (in *Interp) parseData(datum Value, loc Span) (expr, error) {
+	l, err := newDataLexer(datum, loc)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{l: l, macros: make(map[string]bool)}
+	for name := range in.macros {
+		p.macros[name] = true
+	}
+	e, err := p.expr()
+	if err == io.EOF {
+		return nil, fmt.Errorf("unexpected end of code")
+	}
+	return e, err
+}
+
+// callMacro calls the transformer fn for a macro called at loc. Errors
+// are attributed to the call rather than to Go, which is what called fn.
+func (in *Interp) callMacro(fn Value, args []Value, loc Span) (Value, error) {
+	val, err := in.engine.Call(fn, args...)
+	if rerr, ok := err.(*RuntimeError); ok {
+		if !rerr.located() {
+			rerr.Loc = loc
+		}
+		if n := len(rerr.Stack); n > 0 && rerr.Stack[n-1].Call.Line == 0 {
+			rerr.Stack[n-1].Call = loc.Start
+		}
+	}
+	return val, err
+}
+
+// macroexpand1 expands form once if it is a call to a macro, and reports
+// whether it was.
+func (in *Interp) macroexpand1(form Value) (Value, bool, error) {
+	list, ok := form.(ListVal)
+	if !ok || len(list) == 0 {
+		return form, false, nil
+	}
+	sym, ok := list[0].(SymVal)
+	if !ok {
+		return form, false, nil
+	}
+	fn, ok := in.macros[sym.String()]
+	if !ok {
+		return form, false, nil
+	}
+	val, err := in.engine.Call(fn, list[1:]...)
+	return val, true, err
+}
+
+// macroexpand expands form until it is no longer a call to a macro.
+func (in *Interp) macroexpand(form Value) (Value, error) {
+	for depth := 0; ; depth++ {
+		if depth == maxExpansionDepth {
+			return nil, newError(EvalErr, "macro expansion too deep")
+		}
+		val, ok, err := in.macroexpand1(form)
+		if err != nil || !ok {
+			return val, err
+		}
+		form = val
+	}
+}
+
+// expander is the pass between parsing and resolving that replaces calls
+// to macros with their expansions, and defines the macros made by defmacro
+// as it reaches them.
+type expander struct {
+	in    *Interp
+	depth int
+}
+
+func (x *expander) errorf(e expr, format string, args ...interface{}) error {
+	return &SyntaxError{e.Span().Start, fmt.Errorf(format, args...)}
+}
+
+// expand expands each of exprs, skipping nil ones.
+func (x *expander) expand(exprs ...expr) error {
+	for _, e := range exprs {
+		if e == nil {
+			continue
+		}
+		if err := e.visit(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *expander) visitCall(e *callExpr) error {
+	if err := x.expand(e.Fn); err != nil {
+		return err
+	}
+	return x.expand(e.Args...)
+}
+
+// params expands the defaults of the optional and keyword params.
+func (x *expander) params(params *paramList) error {
+	for _, opt := range params.Defaults() {
+		if err := x.expand(opt.Default); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *expander) visitFunc(e *funcExpr) error {
+	if err := x.params(e.Params); err != nil {
+		return err
+	}
+	return x.expand(e.Body)
+}
+
+func (x *expander) visitDef(e *defExpr) error {
+	return x.expand(e.Binding)
+}
+
+func (x *expander) visitDefun(e *defunExpr) error {
+	if err := x.params(e.Params); err != nil {
+		return err
+	}
+	return x.expand(e.Body)
+}
+
+func (x *expander) visitSet(e *setExpr) error {
+	return x.expand(e.Value)
+}
+
+// visitDefmacro evaluates the transformer of the macro as soon as the
+// defmacro is expanded, so that the forms after it can call the macro. The
+// transformer may use the functions defined by the forms before it.
+func (x *expander) visitDefmacro(e *defmacroExpr) error {
+	if err := x.expand(e.Fn); err != nil {
+		return err
+	}
+	if err := x.in.resolver.resolve(e.Fn); err != nil {
+		return err
+	}
+	fn, err := x.in.engine.Eval(e.Fn)
+	if err != nil {
+		return err
+	}
+	x.in.macros[e.Name] = fn
+	return nil
+}
+
+func (x *expander) visitMacro(e *macroExpr) error {
+	fn, ok := x.in.macros[e.Name]
+	if !ok {
+		return x.errorf(e, "undefined macro: %s", e.Name)
+	}
+	if x.depth == maxExpansionDepth {
+		return x.errorf(e, "macro expansion too deep: %s", e.Name)
+	}
+	code, err := x.in.callMacro(fn, e.Args, e.Loc)
+	if err != nil {
+		return err
+	}
+	expansion, err := x.in.parseData(code, e.Loc)
+	if err != nil {
+		return x.errorf(e, "failed to expand %s: %w", e.Name, err)
+	}
+	x.depth++
+	err = x.expand(expansion)
+	x.depth--
+	e.Expansion = expansion
+	return err
+}
+
+func (x *expander) visitIf(e *ifExpr) error {
+	return x.expand(e.Antecedent, e.Consequent, e.Alternate)
+}
+
+func (x *expander) visitSeq(e *seqExpr) error {
+	return x.expand(e.Body...)
+}
+
+func (x *expander) visitLet(e *letExpr) error {
+	if err := x.expand(e.Inits...); err != nil {
+		return err
+	}
+	return x.expand(e.Body)
+}
+
+func (x *expander) visitCond(e *condExpr) error {
+	for _, clause := range e.Clauses {
+		if err := x.expand(clause.Test, clause.Body); err != nil {
+			return err
+		}
+	}
+	return x.expand(e.Else)
+}
+
+func (x *expander) visitWhen(e *whenExpr) error {
+	return x.expand(e.Test, e.Body)
+}
+
+func (x *expander) visitLogic(e *logicExpr) error {
+	return x.expand(e.Args...)
+}
+
+func (x *expander) visitCase(e *caseExpr) error {
+	if err := x.expand(e.Key); err != nil {
+		return err
+	}
+	for _, clause := range e.Clauses {
+		if err := x.expand(clause.Body); err != nil {
+			return err
+		}
+	}
+	return x.expand(e.Else)
+}
+
+func (x *expander) visitMatch(e *matchExpr) error {
+	if err := x.expand(e.Subject); err != nil {
+		return err
+	}
+	for _, clause := range e.Clauses {
+		if err := x.expand(clause.Pattern.Preds()...); err != nil {
+			return err
+		}
+		if err := x.expand(clause.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *expander) visitTry(e *tryExpr) error {
+	if err := x.expand(e.Body); err != nil {
+		return err
+	}
+	for _, clause := range e.Catches {
+		if err := x.expand(clause.Pred, clause.Body); err != nil {
+			return err
+		}
+	}
+	return x.expand(e.Finally)
+}
+
+func (x *expander) visitQuote(e *quoteExpr) error {
+	return nil
+}
+
+func (x *expander) visitQuasi(e *quasiExpr) error {
+	return x.expand(e.Elems...)
+}
+
+func (x *expander) visitIdent(e *identExpr) error {
+	return nil
+}
+
+func (x *expander) visitNum(e *numExpr) error {
+	return nil
+}
+
+func (x *expander) visitStr(e *strExpr) error {
+	return nil
+}
+
+func (x *expander) visitBool(e *boolExpr) error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package interp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMacroCallsEarlierFunctions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, out *bytes.Buffer) {
+		_, err := in.EvalString(`
+			(defun helper (x) (list 'print x))
+			(defmacro m (x) (helper x))
+			(m 1)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != "1\n" {
+			t.Errorf("got output %q, want %q", got, "1\n")
+		}
+	})
+}
+
+func TestMacroExpansion(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		evalTests{
+			// A macro that expands to a call to another macro.
+			{"(defmacro my-if (c a b) `(cond (,c ,a) (else ,b)))", "null"},
+			{"(defmacro my-unless (c a b) `(my-if ,c ,b ,a))", "null"},
+			{"(my-unless #f 1 2)", "1"},
+			// Macro calls in the arguments of a macro call.
+			{"(my-unless (my-if #t #f #t) (my-if #f 'x 'y) 'z)", "y"},
+			// Macro calls in the expansion of a macro call.
+			{"(defmacro twice (x) `(list ,x ,x))", "null"},
+			{"(defmacro pair-of-ifs () '(twice (my-if #t 1 2)))", "null"},
+			{"(pair-of-ifs)", "[1, 1]"},
+			{"(macroexpand '(my-unless a b c))", "[cond, [a, c], [else, b]]"},
+			{"(macroexpand-1 '(my-unless a b c))", "[my-if, a, c, b]"},
+			// Functions may still refer to functions defined after them.
+			{"(seq (defun f () (g)) (defun g () 3) (f))", "3"},
+		}.run(t, in)
+	})
+}
+
+func TestMacroExpansionDepth(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		for _, tc := range []struct {
+			src  string
+			want string
+		}{
+			{"(defmacro forever (x) (list 'forever x)) (forever 1)", "macro expansion too deep: forever"},
+			{"(macroexpand '(forever 1))", "macro expansion too deep"},
+		} {
+			_, err := in.EvalString(tc.src)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("%s: got error %v, want %q", tc.src, err, tc.want)
+			}
+		}
+	})
+	// Nesting up to the limit is allowed.
+	in := New(Options{})
+	_, err := in.EvalString(`
+		(defmacro count-down (n)
+		  (if (= n 0) 0 (list 'count-down (- n 1))))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.EvalString("(count-down 999)"); err != nil {
+		t.Errorf("999 nested expansions: %s", err)
+	}
+	if _, err := in.EvalString("(count-down 1000)"); err == nil {
+		t.Errorf("1000 nested expansions: got no error")
+	}
+}
@@ -0,0 +1,58 @@
+package interp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTypePredicates(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		in.Define("m", MapVal{StrVal("k"): NumVal(1)})
+		evalTests{
+			{"(list (number? 1) (number? 1.5) (number? 1/2) (number? \"1\"))", "[true, true, true, false]"},
+			{"(list (string? \"a\") (string? 'a))", "[true, false]"},
+			{"(list (list? '()) (list? '(1)) (list? null))", "[true, true, false]"},
+			{"(list (map? m) (map? '()))", "[true, false]"},
+			{"(list (fn? (fn (x) x)) (fn? print) (fn? 'print))", "[true, true, false]"},
+			{"(list (null? null) (null? '()) (null? #f))", "[true, false, false]"},
+			{"(list (bool? #f) (bool? null))", "[true, false]"},
+		}.run(t, in)
+	})
+}
+
+func TestMatch(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		in.Define("m", MapVal{StrVal("k"): NumVal(1), NumVal(2): StrVal("v")})
+		evalTests{
+			{"(match 1 ((? number? x) x))", "1"},
+			{"(match \"a\" ((? number? x) 'num) ((? string? s) s))", "a"},
+			{"(match null ((? list? _) 'list) ((? null? _) 'null))", "null"},
+			{"(match print ((? fn? f) 'fn))", "fn"},
+			{"(match m ((? map? (&map \"k\" v 2 w)) (list v w)))", "[1, v]"},
+			{"(match m ((&map \"missing\" v) v) (_ 'none))", "none"},
+			{"(match '(1 (2 3) 4) ((a (b c) . rest) (list a b c rest)))", "[1, 2, 3, [4]]"},
+			{"(match '(1 2) ((a) 'one) ((a b c) 'three) (_ 'other))", "other"},
+			{"(match '(:add 1 2) ((:sub a b) (- a b)) ((:add a b) (+ a b)))", "3"},
+			{"(match 'stop ('go 1) ('stop 2))", "2"},
+			{"(match '(3 3) ((x (? (fn (y) (= x y)))) 'same) (_ 'different))", "same"},
+			{"(match '(3 4) ((x (? (fn (y) (= x y)))) 'same) (_ 'different))", "different"},
+			{"(let ((x 5)) (match '(1) ((x) x)))", "1"},
+		}.run(t, in)
+	})
+}
+
+func TestMatchFailure(t *testing.T) {
+	var msgs []string
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		_, err := in.EvalString("(match '(1 2 3) ((a b) 'pair) (() 'empty))")
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) || rerr.Kind != MatchErr {
+			t.Fatalf("got %v, want a match error", err)
+		}
+		msgs = append(msgs, err.Error())
+	})
+	if len(msgs) == 2 && msgs[0] != msgs[1] {
+		t.Errorf("engines disagree: %q and %q", msgs[0], msgs[1])
+	}
+}
@@ -0,0 +1,528 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Numbers form a tower of four representations, all of type NumT:
+// NumVal (a Go int), BigIntVal, RatVal (exact fractions) and FloatVal.
+// Exact results are always stored in the simplest representation that
+// holds them, so an integer that fits in an int is a NumVal and a
+// fraction with denominator 1 is an integer. Operations on mixed
+// representations promote both operands to the higher one, and
+// operations on ints that overflow are retried on big ints.
+
+// BigIntVal is an integer that does not fit in a NumVal.
+type BigIntVal struct {
+	i *big.Int
+}
+
+func (BigIntVal) Type() ValType {
+	return NumT
+}
+
+func (v BigIntVal) Value() *big.Int {
+	return new(big.Int).Set(v.i)
+}
+
+func (v BigIntVal) String() string {
+	return v.i.String()
+}
+
+// RatVal is an exact fraction whose denominator is not 1.
+type RatVal struct {
+	r *big.Rat
+}
+
+func (RatVal) Type() ValType {
+	return NumT
+}
+
+func (v RatVal) Value() *big.Rat {
+	return new(big.Rat).Set(v.r)
+}
+
+func (v RatVal) String() string {
+	return v.r.String()
+}
+
+// FloatVal is an inexact number. Any operation involving a float has a
+// float result.
+type FloatVal float64
+
+func (FloatVal) Type() ValType {
+	return NumT
+}
+
+func (v FloatVal) Value() float64 {
+	return float64(v)
+}
+
+// String formats v so that it always reads back as a float, e.g. 2.0
+// rather than 2.
+func (v FloatVal) String() string {
+	s := strconv.FormatFloat(float64(v), 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// normInt returns i as a NumVal if it fits, or a BigIntVal otherwise.
+func normInt(i *big.Int) Value {
+	if i.IsInt64() && int64(int(i.Int64())) == i.Int64() {
+		return NumVal(i.Int64())
+	}
+	return BigIntVal{i}
+}
+
+// normRat returns r as an integer if its denominator is 1, or a RatVal
+// otherwise.
+func normRat(r *big.Rat) Value {
+	if r.IsInt() {
+		return normInt(new(big.Int).Set(r.Num()))
+	}
+	return RatVal{r}
+}
+
+// parseNum parses a number literal: an integer, a fraction like 1/3 or a
+// float like 1.5 or 1e-3.
+func parseNum(lit string) (Value, error) {
+	if strings.Contains(lit, "/") {
+		r, ok := new(big.Rat).SetString(lit)
+		if !ok {
+			return nil, fmt.Errorf("bad number: %s", lit)
+		}
+		return normRat(r), nil
+	}
+	if strings.ContainsAny(lit, ".eE") {
+		f, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number: %s", lit)
+		}
+		return FloatVal(f), nil
+	}
+	i, ok := new(big.Int).SetString(lit, 10)
+	if !ok {
+		return nil, fmt.Errorf("bad number: %s", lit)
+	}
+	return normInt(i), nil
+}
+
+// minInt is the smallest NumVal.
+const minInt = -1 << (strconv.IntSize - 1)
+
+// numLevel is the position of a representation in the tower.
+type numLevel int
+
+const (
+	intLevel numLevel = iota + 1
+	bigLevel
+	ratLevel
+	floatLevel
+)
+
+func levelOf(v Value) numLevel {
+	switch v.(type) {
+	case NumVal:
+		return intLevel
+	case BigIntVal:
+		return bigLevel
+	case RatVal:
+		return ratLevel
+	case FloatVal:
+		return floatLevel
+	}
+	panic(fmt.Errorf("not a number: %s", v))
+}
+
+func toBig(v Value) *big.Int {
+	switch v := v.(type) {
+	case NumVal:
+		return big.NewInt(int64(v))
+	case BigIntVal:
+		return v.i
+	}
+	panic(fmt.Errorf("not an integer: %s", v))
+}
+
+func toRat(v Value) *big.Rat {
+	switch v := v.(type) {
+	case NumVal, BigIntVal:
+		return new(big.Rat).SetInt(toBig(v))
+	case RatVal:
+		return v.r
+	}
+	panic(fmt.Errorf("not exact: %s", v))
+}
+
+func toFloat(v Value) float64 {
+	switch v := v.(type) {
+	case NumVal:
+		return float64(v)
+	case BigIntVal:
+		f, _ := new(big.Float).SetInt(v.i).Float64()
+		return f
+	case RatVal:
+		f, _ := v.r.Float64()
+		return f
+	case FloatVal:
+		return float64(v)
+	}
+	panic(fmt.Errorf("not a number: %s", v))
+}
+
+func isInteger(v Value) bool {
+	switch v.(type) {
+	case NumVal, BigIntVal:
+		return true
+	}
+	return false
+}
+
+func isZero(v Value) bool {
+	switch v := v.(type) {
+	case NumVal:
+		return v == 0
+	case FloatVal:
+		return v == 0
+	}
+	// Big ints and rats are never zero, since zero is a NumVal.
+	return false
+}
+
+func sign(v Value) int {
+	switch v := v.(type) {
+	case NumVal:
+		switch {
+		case v < 0:
+			return -1
+		case v > 0:
+			return 1
+		}
+		return 0
+	case BigIntVal:
+		return v.i.Sign()
+	case RatVal:
+		return v.r.Sign()
+	}
+	f := toFloat(v)
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+	return 0
+}
+
+// numOp is an arithmetic operation with an implementation for each level
+// of the tower. If int reports an overflow, or a level has no
+// implementation, the operands are promoted to the next level.
+type numOp struct {
+	int   func(a, b int) (int, bool)
+	big   func(a, b *big.Int) *big.Int
+	rat   func(a, b *big.Rat) *big.Rat
+	float func(a, b float64) float64
+}
+
+func (op numOp) apply(a, b Value) Value {
+	level := levelOf(a)
+	if l := levelOf(b); l > level {
+		level = l
+	}
+	if level == intLevel && op.int != nil {
+		if c, ok := op.int(int(a.(NumVal)), int(b.(NumVal))); ok {
+			return NumVal(c)
+		}
+		level = bigLevel
+	}
+	if level <= bigLevel && op.big != nil {
+		return normInt(op.big(toBig(a), toBig(b)))
+	}
+	if level <= ratLevel {
+		return normRat(op.rat(toRat(a), toRat(b)))
+	}
+	return FloatVal(op.float(toFloat(a), toFloat(b)))
+}
+
+var addOp = numOp{
+	int: func(a, b int) (int, bool) {
+		c := a + b
+		return c, (c > a) == (b > 0)
+	},
+	big:   func(a, b *big.Int) *big.Int { return new(big.Int).Add(a, b) },
+	rat:   func(a, b *big.Rat) *big.Rat { return new(big.Rat).Add(a, b) },
+	float: func(a, b float64) float64 { return a + b },
+}
+
+var subOp = numOp{
+	int: func(a, b int) (int, bool) {
+		c := a - b
+		return c, (c < a) == (b > 0)
+	},
+	big:   func(a, b *big.Int) *big.Int { return new(big.Int).Sub(a, b) },
+	rat:   func(a, b *big.Rat) *big.Rat { return new(big.Rat).Sub(a, b) },
+	float: func(a, b float64) float64 { return a - b },
+}
+
+var mulOp = numOp{
+	int: func(a, b int) (int, bool) {
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+		if a == -1 && b == minInt || b == -1 && a == minInt {
+			return 0, false
+		}
+		c := a * b
+		return c, c/b == a
+	},
+	big:   func(a, b *big.Int) *big.Int { return new(big.Int).Mul(a, b) },
+	rat:   func(a, b *big.Rat) *big.Rat { return new(big.Rat).Mul(a, b) },
+	float: func(a, b float64) float64 { return a * b },
+}
+
+// divOp divides exactly, so dividing integers that do not divide evenly
+// makes a rational.
+var divOp = numOp{
+	int: func(a, b int) (int, bool) {
+		if b == -1 && a == minInt || a%b != 0 {
+			return 0, false
+		}
+		return a / b, true
+	},
+	rat:   func(a, b *big.Rat) *big.Rat { return new(big.Rat).Quo(a, b) },
+	float: func(a, b float64) float64 { return a / b },
+}
+
+// quotOp and modOp only apply to integers.
+var quotOp = numOp{
+	int: func(a, b int) (int, bool) {
+		if b == -1 && a == minInt {
+			return 0, false
+		}
+		return a / b, true
+	},
+	big: func(a, b *big.Int) *big.Int { return new(big.Int).Quo(a, b) },
+}
+
+// modOp has the sign of the divisor, so (mod -1 3) is 2.
+var modOp = numOp{
+	int: func(a, b int) (int, bool) {
+		if b == -1 {
+			return 0, true
+		}
+		m := a % b
+		if m != 0 && (m < 0) != (b < 0) {
+			m += b
+		}
+		return m, true
+	},
+	big: func(a, b *big.Int) *big.Int {
+		m := new(big.Int).Rem(a, b)
+		if m.Sign() != 0 && m.Sign() != b.Sign() {
+			m.Add(m, b)
+		}
+		return m
+	},
+}
+
+// compareNums returns -1, 0 or 1 as a is less than, equal to or greater
+// than b. If either is NaN the numbers are unordered and ok is false.
+func compareNums(a, b Value) (cmp int, ok bool) {
+	level := levelOf(a)
+	if l := levelOf(b); l > level {
+		level = l
+	}
+	switch level {
+	case intLevel:
+		x, y := a.(NumVal), b.(NumVal)
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case bigLevel:
+		return toBig(a).Cmp(toBig(b)), true
+	case ratLevel:
+		return toRat(a).Cmp(toRat(b)), true
+	}
+	x, y := toFloat(a), toFloat(b)
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	case x == y:
+		return 0, true
+	}
+	return 0, false
+}
+
+// foldBuiltin makes a builtin taking at least min numbers that folds step
+// over them from the left. Called with a single argument x it returns
+// (step unit x), so (- x) negates x, and with none it returns unit. If
+// unit is nil the first argument is used instead.
+func foldBuiltin(min int, unit Value, step func(a, b Value) (Value, error)) BuiltInFuncVal {
+	params := make([]ValType, min+1)
+	for i := range params {
+		params[i] = NumT
+	}
+	return BuiltInFuncVal{params: params, variadic: true, f: func(args ...Value) (Value, error) {
+		acc := unit
+		if len(args) > 1 || unit == nil {
+			acc, args = args[0], args[1:]
+		}
+		for _, arg := range args {
+			var err error
+			if acc, err = step(acc, arg); err != nil {
+				return nil, err
+			}
+		}
+		return acc, nil
+	}}
+}
+
+// arithBuiltin makes a variadic builtin that applies op to its arguments.
+func arithBuiltin(min int, unit Value, op numOp) BuiltInFuncVal {
+	return foldBuiltin(min, unit, func(a, b Value) (Value, error) {
+		return op.apply(a, b), nil
+	})
+}
+
+// integerBuiltin makes a builtin that applies op to two integers, failing
+// if the second is zero.
+func integerBuiltin(name string, op numOp) BuiltInFuncVal {
+	return BuiltInFuncVal{params: []ValType{NumT, NumT}, f: func(args ...Value) (Value, error) {
+		for i, arg := range args {
+			if !isInteger(arg) {
+				return nil, newError(TypeErr, "%s: argument %d must be an integer, got %s", name, i+1, arg)
+			}
+		}
+		if isZero(args[1]) {
+			return nil, newError(EvalErr, "%s: division by zero", name)
+		}
+		return op.apply(args[0], args[1]), nil
+	}}
+}
+
+// divide divides a by b, failing if both are exact and b is zero.
+func divide(a, b Value) (Value, error) {
+	if isZero(b) && levelOf(a) != floatLevel && levelOf(b) != floatLevel {
+		return nil, newError(EvalErr, "/: division by zero")
+	}
+	return divOp.apply(a, b), nil
+}
+
+func abs(args ...Value) (Value, error) {
+	if sign(args[0]) >= 0 {
+		return args[0], nil
+	}
+	switch x := args[0].(type) {
+	case NumVal:
+		return subOp.apply(NumVal(0), x), nil
+	case BigIntVal:
+		return normInt(new(big.Int).Neg(x.i)), nil
+	case RatVal:
+		return RatVal{new(big.Rat).Neg(x.r)}, nil
+	}
+	return FloatVal(math.Abs(toFloat(args[0]))), nil
+}
+
+// minimum and maximum return NaN if either argument is NaN, as
+// math.Min and math.Max do.
+func minimum(a, b Value) (Value, error) {
+	cmp, ok := compareNums(b, a)
+	switch {
+	case !ok:
+		return FloatVal(math.NaN()), nil
+	case cmp < 0:
+		return b, nil
+	}
+	return a, nil
+}
+
+func maximum(a, b Value) (Value, error) {
+	cmp, ok := compareNums(b, a)
+	switch {
+	case !ok:
+		return FloatVal(math.NaN()), nil
+	case cmp > 0:
+		return b, nil
+	}
+	return a, nil
+}
+
+// floor rounds toward negative infinity. Exact numbers have integer
+// results; floats stay floats.
+func floor(args ...Value) (Value, error) {
+	switch x := args[0].(type) {
+	case RatVal:
+		// The denominator is positive, so Euclidean division floors.
+		return normInt(new(big.Int).Div(x.r.Num(), x.r.Denom())), nil
+	case FloatVal:
+		return FloatVal(math.Floor(float64(x))), nil
+	}
+	return args[0], nil
+}
+
+// exactSqrt returns the square root of i if i is a perfect square.
+func exactSqrt(i *big.Int) (*big.Int, bool) {
+	r := new(big.Int).Sqrt(i)
+	return r, new(big.Int).Mul(r, r).Cmp(i) == 0
+}
+
+// sqrt is exact for perfect squares of exact numbers.
+func sqrt(args ...Value) (Value, error) {
+	x := args[0]
+	if sign(x) < 0 {
+		return nil, newError(EvalErr, "sqrt: negative argument: %s", x)
+	}
+	switch levelOf(x) {
+	case intLevel, bigLevel:
+		if r, ok := exactSqrt(toBig(x)); ok {
+			return normInt(r), nil
+		}
+	case ratLevel:
+		num, ok1 := exactSqrt(x.(RatVal).r.Num())
+		den, ok2 := exactSqrt(x.(RatVal).r.Denom())
+		if ok1 && ok2 {
+			return normRat(new(big.Rat).SetFrac(num, den)), nil
+		}
+	}
+	return FloatVal(math.Sqrt(toFloat(x))), nil
+}
+
+// maxExponent bounds exact exponentiation, whose result would otherwise
+// exhaust memory.
+const maxExponent = 1 << 20
+
+// expt raises base to power. An exact base raised to an integer power is
+// exact; anything else is computed with floats.
+func expt(args ...Value) (Value, error) {
+	base, power := args[0], args[1]
+	if !isInteger(power) || levelOf(base) == floatLevel {
+		return FloatVal(math.Pow(toFloat(base), toFloat(power))), nil
+	}
+	n := toBig(power)
+	if n.CmpAbs(big.NewInt(maxExponent)) > 0 {
+		return nil, newError(EvalErr, "expt: exponent too large: %s", power)
+	}
+	e := new(big.Int).Abs(n)
+	r := toRat(base)
+	num := new(big.Int).Exp(r.Num(), e, nil)
+	den := new(big.Int).Exp(r.Denom(), e, nil)
+	if n.Sign() < 0 {
+		if isZero(base) {
+			return nil, newError(EvalErr, "expt: division by zero")
+		}
+		num, den = den, num
+	}
+	return normRat(new(big.Rat).SetFrac(num, den)), nil
+}
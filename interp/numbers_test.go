@@ -0,0 +1,113 @@
+package interp
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+const maxInt = -(minInt + 1)
+
+func bigInt(s string) Value {
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("bad big int: " + s)
+	}
+	return BigIntVal{i}
+}
+
+func rat(a, b int64) Value {
+	return RatVal{big.NewRat(a, b)}
+}
+
+func ratStr(s string) Value {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic("bad rational: " + s)
+	}
+	return RatVal{r}
+}
+
+func checkNum(t *testing.T, what string, got, want Value) {
+	t.Helper()
+	if got.Type() != want.Type() || got.String() != want.String() {
+		t.Errorf("%s: got %s (%s), want %s (%s)", what, got, got.Type(), want, want.Type())
+	}
+}
+
+func TestOverflowPromotion(t *testing.T) {
+	max, min := NumVal(maxInt), NumVal(minInt)
+	maxBig := new(big.Int).SetInt64(int64(maxInt))
+	minBig := new(big.Int).SetInt64(int64(minInt))
+	for _, tc := range []struct {
+		name string
+		op   numOp
+		a, b Value
+		want Value
+	}{
+		{"max+1", addOp, max, NumVal(1), BigIntVal{new(big.Int).Add(maxBig, big.NewInt(1))}},
+		{"min+-1", addOp, min, NumVal(-1), BigIntVal{new(big.Int).Sub(minBig, big.NewInt(1))}},
+		{"max+0", addOp, max, NumVal(0), max},
+		{"min-1", subOp, min, NumVal(1), BigIntVal{new(big.Int).Sub(minBig, big.NewInt(1))}},
+		{"max--1", subOp, max, NumVal(-1), BigIntVal{new(big.Int).Add(maxBig, big.NewInt(1))}},
+		{"0-min", subOp, NumVal(0), min, BigIntVal{new(big.Int).Neg(minBig)}},
+		{"max*2", mulOp, max, NumVal(2), BigIntVal{new(big.Int).Mul(maxBig, big.NewInt(2))}},
+		{"min*-1", mulOp, min, NumVal(-1), BigIntVal{new(big.Int).Neg(minBig)}},
+		{"-1*min", mulOp, NumVal(-1), min, BigIntVal{new(big.Int).Neg(minBig)}},
+		{"max*0", mulOp, max, NumVal(0), NumVal(0)},
+		// Results that fit again come back down to NumVal.
+		{"(max+1)-1", subOp, BigIntVal{new(big.Int).Add(maxBig, big.NewInt(1))}, NumVal(1), max},
+		{"big*0", mulOp, bigInt("100000000000000000000000"), NumVal(0), NumVal(0)},
+	} {
+		checkNum(t, tc.name, tc.op.apply(tc.a, tc.b), tc.want)
+	}
+}
+
+func TestMixedRationalFloat(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		op   numOp
+		a, b Value
+		want Value
+	}{
+		{"1/2+1/3", addOp, rat(1, 2), rat(1, 3), rat(5, 6)},
+		{"1/2+1/2", addOp, rat(1, 2), rat(1, 2), NumVal(1)},
+		{"1/3*3", mulOp, rat(1, 3), NumVal(3), NumVal(1)},
+		{"1/2-big", subOp, rat(1, 2), bigInt("100000000000000000000"), ratStr("-199999999999999999999/2")},
+		{"1/2+0.25", addOp, rat(1, 2), FloatVal(0.25), FloatVal(0.75)},
+		{"0.5-1/4", subOp, FloatVal(0.5), rat(1, 4), FloatVal(0.25)},
+		{"1/4*2.0", mulOp, rat(1, 4), FloatVal(2), FloatVal(0.5)},
+		{"1/4/0.5", divOp, rat(1, 4), FloatVal(0.5), FloatVal(0.5)},
+		{"1/2/2", divOp, rat(1, 2), NumVal(2), rat(1, 4)},
+		{"1/2+big", addOp, rat(1, 2), bigInt("100000000000000000000"), ratStr("200000000000000000001/2")},
+	} {
+		checkNum(t, tc.name, tc.op.apply(tc.a, tc.b), tc.want)
+	}
+}
+
+func TestMinMaxNaN(t *testing.T) {
+	nan := FloatVal(math.NaN())
+	for _, tc := range []struct {
+		name string
+		f    func(a, b Value) (Value, error)
+		a, b Value
+	}{
+		{"min NaN 1", minimum, nan, NumVal(1)},
+		{"min 1 NaN", minimum, NumVal(1), nan},
+		{"max NaN 1", maximum, nan, NumVal(1)},
+		{"max 1 NaN", maximum, NumVal(1), nan},
+		{"max 1/2 NaN", maximum, rat(1, 2), nan},
+	} {
+		got, err := tc.f(tc.a, tc.b)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if f, ok := got.(FloatVal); !ok || !math.IsNaN(float64(f)) {
+			t.Errorf("%s: got %s, want NaN", tc.name, got)
+		}
+	}
+	got, _ := maximum(NumVal(1), rat(3, 2))
+	checkNum(t, "max 1 3/2", got, rat(3, 2))
+	got, _ = minimum(FloatVal(0.5), rat(1, 3))
+	checkNum(t, "min 0.5 1/3", got, rat(1, 3))
+}
@@ -0,0 +1,1240 @@
+package interp
+
+import (
+	"fmt"
+	"io"
+)
+
+// SyntaxError is a static error in a program: malformed input reported by
+// Parse, or a bad name reported by Resolve. Pos is where the error was
+// detected.
+type SyntaxError struct {
+	Pos Pos
+	Err error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Err)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// unterminatedError reports input that ends inside a list. It wraps
+// io.EOF, so that a REPL can tell that more input may complete it.
+type unterminatedError struct {
+	open Pos
+}
+
+func (e unterminatedError) Error() string {
+	return fmt.Sprintf("unterminated list opened at %d:%d", e.open.Line, e.open.Col)
+}
+
+func (e unterminatedError) Unwrap() error {
+	return io.EOF
+}
+
+// tokenSource is where a parser reads tokens from: a lexer, or a
+// dataLexer when parsing the code returned by a macro.
+type tokenSource interface {
+	Peek() (token, error)
+	Next() (token, error)
+}
+
+type parser struct {
+	l         tokenSource
+	last      token           // the last token examined, used to position errors
+	opens     []Pos           // positions of the parens not yet closed
+	macros    map[string]bool // names of macros, whose calls are read as data
+	defmacros int             // the number of defmacros read so far
+}
+
+func newParser(l lexer) parser {
+	return parser{l: &l, macros: make(map[string]bool)}
+}
+
+func (p *parser) peek() (token, error) {
+	tok, err := p.l.Peek()
+	p.last = tok
+	return tok, err
+}
+
+func (p *parser) next() (token, error) {
+	tok, err := p.l.Next()
+	p.last = tok
+	switch {
+	case err != nil:
+	case tok.Typ == tokLParen:
+		p.opens = append(p.opens, tok.Loc.Start)
+	case tok.Typ == tokRParen && len(p.opens) > 0:
+		p.opens = p.opens[:len(p.opens)-1]
+	}
+	return tok, err
+}
+
+func (p *parser) eatLitOrDie(lit string) token {
+	tok, err := p.next()
+	if err != nil {
+		panic(err)
+	}
+	if tok.Lit != lit {
+		panic(fmt.Errorf("expected %s, got %s", lit, tok.Lit))
+	}
+	return tok
+}
+
+func (p *parser) eat(typ tokType) (token, error) {
+	tok, err := p.next()
+	if err != nil {
+		return emptyToken, err
+	}
+	if tok.Typ != typ {
+		return emptyToken, fmt.Errorf("expected %s, got %s", typ, tok)
+	}
+	return tok, nil
+}
+
+func (p *parser) callExpr(start Pos) (*callExpr, error) {
+	fn, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse call: %w", err)
+	}
+	var args []expr
+	for {
+		if tok, _ := p.peek(); tok.Typ == tokRParen {
+			break
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse call: %w", err)
+		}
+		args = append(args, arg)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse call: %w", err)
+	}
+	return &callExpr{fn, args, Span{start, end.Loc.End}}, nil
+}
+
+// paramSections orders the markers that start each kind of parameter.
+var paramSections = map[string]int{
+	"&optional": 1,
+	"&rest":     2,
+	".":         2,
+	"&key":      3,
+}
+
+// params parses a parenthesized parameter list.
+func (p *parser) params() (*paramList, error) {
+	if _, err := p.eat(tokLParen); err != nil {
+		return nil, err
+	}
+	params := &paramList{}
+	section := ""
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Typ == tokRParen {
+			break
+		}
+		if next, ok := paramSections[tok.Lit]; ok && tok.Typ == tokIdent {
+			if next <= paramSections[section] {
+				return nil, fmt.Errorf("unexpected %s in parameters", tok.Lit)
+			}
+			if section == "&rest" && params.Rest == nil {
+				return nil, fmt.Errorf("missing &rest parameter")
+			}
+			p.next()
+			section = tok.Lit
+			if section == "." {
+				// (a b . rest) is short for (a b &rest rest).
+				section = "&rest"
+			}
+			continue
+		}
+		switch section {
+		case "":
+			pat, err := p.pattern()
+			if err != nil {
+				return nil, err
+			}
+			params.Required = append(params.Required, pat)
+		case "&optional", "&key":
+			opt, err := p.optParam()
+			if err != nil {
+				return nil, err
+			}
+			if section == "&key" {
+				params.Key = append(params.Key, opt)
+			} else {
+				params.Optional = append(params.Optional, opt)
+			}
+		case "&rest":
+			if params.Rest != nil {
+				return nil, fmt.Errorf("more than one &rest parameter")
+			}
+			if params.Rest, err = p.pattern(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if section == "&rest" && params.Rest == nil {
+		return nil, fmt.Errorf("missing &rest parameter")
+	}
+	if _, err := p.eat(tokRParen); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// pattern parses a name or a list or map pattern to destructure.
+func (p *parser) pattern() (*pattern, error) {
+	if tok, _ := p.peek(); tok.Typ != tokLParen {
+		name, err := p.identExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &pattern{Kind: namePattern, Name: name, Loc: name.Loc}, nil
+	}
+	start, _ := p.next()
+	return p.listPattern(start, p.pattern)
+}
+
+// listPattern parses the rest of a list or map pattern whose opening paren
+// has been read. The patterns in it are parsed by elem.
+func (p *parser) listPattern(start token, elem func() (*pattern, error)) (*pattern, error) {
+	pat := &pattern{Kind: listPattern}
+	if tok, _ := p.peek(); tok.Typ == tokIdent && tok.Lit == "&map" {
+		p.next()
+		pat.Kind = mapPattern
+	}
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Typ == tokRParen {
+			break
+		}
+		if pat.Kind == listPattern && tok.Typ == tokIdent && tok.Lit == "." {
+			p.next()
+			if pat.Rest, err = elem(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if pat.Kind == mapPattern {
+			key, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			pat.Keys = append(pat.Keys, key)
+		}
+		sub, err := elem()
+		if err != nil {
+			return nil, err
+		}
+		pat.Elems = append(pat.Elems, sub)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, err
+	}
+	pat.Loc = Span{start.Loc.Start, end.Loc.End}
+	return pat, nil
+}
+
+// matchPattern parses the pattern of a match clause. Besides names and
+// list and map patterns, it may be a wildcard, a literal, a quoted datum or
+// a predicate.
+func (p *parser) matchPattern() (*pattern, error) {
+	tok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tok.Typ == tokQuote:
+		p.next()
+		datum, err := p.datum()
+		if err != nil {
+			return nil, err
+		}
+		return dataPattern(datum, Span{tok.Loc.Start, p.last.Loc.End}), nil
+	case tok.Typ == tokIdent && tok.Lit == "_":
+		p.next()
+		return &pattern{Kind: wildcardPattern, Loc: tok.Loc}, nil
+	case tok.Typ == tokIdent && tok.Lit != "null" && !isKeywordArg(tok.Lit):
+		name, err := p.identExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &pattern{Kind: namePattern, Name: name, Loc: name.Loc}, nil
+	case tok.Typ != tokLParen:
+		val, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		return &pattern{Kind: literalPattern, Value: val, Loc: tok.Loc}, nil
+	}
+	start, _ := p.next()
+	if tok, _ := p.peek(); tok.Typ != tokIdent || tok.Lit != "?" {
+		return p.listPattern(start, p.matchPattern)
+	}
+	p.next()
+	pat := &pattern{Kind: predPattern}
+	if pat.Pred, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if tok, _ := p.peek(); tok.Typ != tokRParen {
+		sub, err := p.matchPattern()
+		if err != nil {
+			return nil, err
+		}
+		pat.Elems = []*pattern{sub}
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, err
+	}
+	pat.Loc = Span{start.Loc.Start, end.Loc.End}
+	return pat, nil
+}
+
+// dataPattern returns the pattern that matches datum: a list pattern for
+// a list and a literal pattern for anything else.
+func dataPattern(datum Value, loc Span) *pattern {
+	list, ok := datum.(ListVal)
+	if !ok {
+		return &pattern{Kind: literalPattern, Value: datum, Loc: loc}
+	}
+	pat := &pattern{Kind: listPattern, Loc: loc}
+	for _, elem := range list {
+		pat.Elems = append(pat.Elems, dataPattern(elem, loc))
+	}
+	return pat
+}
+
+// optParam parses an optional or keyword parameter, which is either a
+// name or a name and default in parentheses.
+func (p *parser) optParam() (*optParam, error) {
+	if tok, _ := p.peek(); tok.Typ != tokLParen {
+		name, err := p.identExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &optParam{Name: name}, nil
+	}
+	p.next()
+	name, err := p.identExpr()
+	if err != nil {
+		return nil, err
+	}
+	def, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.eat(tokRParen); err != nil {
+		return nil, err
+	}
+	return &optParam{Name: name, Default: def}, nil
+}
+
+func (p *parser) funcExpr(start Pos) (*funcExpr, error) {
+	p.eatLitOrDie("fn")
+	params, err := p.params()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fn: %w", err)
+	}
+	body, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fn: %w", err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fn: %w", err)
+	}
+	return &funcExpr{Params: params, Body: body, Loc: Span{start, end.Loc.End}}, nil
+}
+
+func (p *parser) defExpr(start Pos) (*defExpr, error) {
+	p.eatLitOrDie("def")
+	name, err := p.identExpr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse def: %w", err)
+	}
+	binding, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse def: %w", err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse def: %w", err)
+	}
+	return &defExpr{Name: name.Ident, Binding: binding, Loc: Span{start, end.Loc.End}}, nil
+}
+
+func (p *parser) setExpr(start Pos) (*setExpr, error) {
+	p.eatLitOrDie("set!")
+	name, err := p.identExpr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse set!: %w", err)
+	}
+	val, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse set!: %w", err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse set!: %w", err)
+	}
+	return &setExpr{Name: name, Value: val, Loc: Span{start, end.Loc.End}}, nil
+}
+
+func (p *parser) defunExpr(start Pos) (*defunExpr, error) {
+	p.eatLitOrDie("defun")
+	name, err := p.identExpr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse defun: %w", err)
+	}
+	params, err := p.params()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fn: %w", err)
+	}
+	body, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fn: %w", err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fn: %w", err)
+	}
+	return &defunExpr{Name: name.Ident, Params: params, Body: body, Loc: Span{start, end.Loc.End}}, nil
+}
+
+// defmacroExpr parses a defmacro. Calls to the macro that follow it are
+// read as data by macroExpr.
+func (p *parser) defmacroExpr(start Pos) (*defmacroExpr, error) {
+	p.eatLitOrDie("defmacro")
+	name, err := p.identExpr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse defmacro: %w", err)
+	}
+	params, err := p.params()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse defmacro: %w", err)
+	}
+	body, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse defmacro: %w", err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse defmacro: %w", err)
+	}
+	loc := Span{start, end.Loc.End}
+	p.macros[name.Ident] = true
+	p.defmacros++
+	fn := &funcExpr{Name: name.Ident, Params: params, Body: body, Loc: loc}
+	return &defmacroExpr{Name: name.Ident, Fn: fn, Loc: loc}, nil
+}
+
+func (p *parser) macroExpr(start Pos) (*macroExpr, error) {
+	name, _ := p.next()
+	args := ListVal{}
+	for {
+		if tok, _ := p.peek(); tok.Typ == tokRParen {
+			break
+		}
+		arg, err := p.datum()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name.Lit, err)
+		}
+		args = append(args, arg)
+	}
+	end, _ := p.next()
+	return &macroExpr{Name: name.Lit, Args: args, Loc: Span{start, end.Loc.End}}, nil
+}
+
+func (p *parser) ifExpr(start Pos) (*ifExpr, error) {
+	p.eatLitOrDie("if")
+	ant, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse if: %w", err)
+	}
+	con, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse if: %w", err)
+	}
+	alt, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse if: %w", err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse if: %w", err)
+	}
+	return &ifExpr{ant, con, alt, Span{start, end.Loc.End}}, nil
+}
+
+func (p *parser) seqExpr(start Pos) (*seqExpr, error) {
+	p.eatLitOrDie("seq")
+	var body []expr
+	for {
+		if tok, _ := p.peek(); tok.Typ == tokRParen {
+			break
+		}
+		expr, err := p.expr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse seq: %w", err)
+		}
+		body = append(body, expr)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse seq: %w", err)
+	}
+	return &seqExpr{body, Span{start, end.Loc.End}}, nil
+}
+
+// body parses the expressions up to the closing paren of a form, which
+// must be at least one. Several expressions are wrapped in a seqExpr.
+func (p *parser) body() (expr, error) {
+	var body []expr
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Typ == tokRParen {
+			break
+		}
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, expr)
+	}
+	return p.seq(body)
+}
+
+// seq returns the single expression in body, or a seqExpr of several.
+func (p *parser) seq(body []expr) (expr, error) {
+	switch len(body) {
+	case 0:
+		return nil, fmt.Errorf("expected body, got %s", p.last)
+	case 1:
+		return body[0], nil
+	}
+	loc := Span{body[0].Span().Start, body[len(body)-1].Span().End}
+	return &seqExpr{body, loc}, nil
+}
+
+func (p *parser) letExpr(start Pos) (*letExpr, error) {
+	form := p.last.Lit
+	p.eatLitOrDie(form)
+	e := &letExpr{}
+	switch form {
+	case "let":
+		e.Kind = letPlain
+	case "let*":
+		e.Kind = letStar
+	case "letrec":
+		e.Kind = letRec
+	}
+	if _, err := p.eat(tokLParen); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+	}
+	for {
+		if tok, _ := p.peek(); tok.Typ == tokRParen {
+			break
+		}
+		if _, err := p.eat(tokLParen); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+		}
+		pat, err := p.pattern()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+		}
+		init, err := p.expr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+		}
+		if _, err := p.eat(tokRParen); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+		}
+		e.Patterns = append(e.Patterns, pat)
+		e.Inits = append(e.Inits, init)
+	}
+	if _, err := p.eat(tokRParen); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+	}
+	body, err := p.body()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+	}
+	e.Body = body
+	e.Loc = Span{start, end.Loc.End}
+	return e, nil
+}
+
+// elseClause parses the rest of an else clause whose opening paren has
+// been read.
+func (p *parser) elseClause() (expr, error) {
+	p.eatLitOrDie("else")
+	body, err := p.body()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.eat(tokRParen); err != nil {
+		return nil, err
+	}
+	if tok, _ := p.peek(); tok.Typ != tokRParen {
+		return nil, fmt.Errorf("else must be the last clause, got %s", tok)
+	}
+	return body, nil
+}
+
+func (p *parser) condExpr(start Pos) (*condExpr, error) {
+	p.eatLitOrDie("cond")
+	e := &condExpr{}
+	for {
+		if tok, _ := p.peek(); tok.Typ == tokRParen {
+			break
+		}
+		if _, err := p.eat(tokLParen); err != nil {
+			return nil, fmt.Errorf("failed to parse cond: %w", err)
+		}
+		if tok, _ := p.peek(); tok.Typ == tokKeyword && tok.Lit == "else" {
+			body, err := p.elseClause()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse cond: %w", err)
+			}
+			e.Else = body
+			continue
+		}
+		test, err := p.expr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cond: %w", err)
+		}
+		body, err := p.body()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cond: %w", err)
+		}
+		if _, err := p.eat(tokRParen); err != nil {
+			return nil, fmt.Errorf("failed to parse cond: %w", err)
+		}
+		e.Clauses = append(e.Clauses, &condClause{Test: test, Body: body})
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cond: %w", err)
+	}
+	e.Loc = Span{start, end.Loc.End}
+	return e, nil
+}
+
+func (p *parser) whenExpr(start Pos) (*whenExpr, error) {
+	form := p.last.Lit
+	p.eatLitOrDie(form)
+	test, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+	}
+	body, err := p.body()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+	}
+	return &whenExpr{Unless: form == "unless", Test: test, Body: body, Loc: Span{start, end.Loc.End}}, nil
+}
+
+func (p *parser) logicExpr(start Pos) (*logicExpr, error) {
+	form := p.last.Lit
+	p.eatLitOrDie(form)
+	var args []expr
+	for {
+		if tok, _ := p.peek(); tok.Typ == tokRParen {
+			break
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+		}
+		args = append(args, arg)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", form, err)
+	}
+	return &logicExpr{Or: form == "or", Args: args, Loc: Span{start, end.Loc.End}}, nil
+}
+
+// literal parses a constant: a number, a string, a bool, null or a
+// symbol.
+func (p *parser) literal() (Value, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tok.Typ == tokNum:
+		return parseNum(tok.Lit)
+	case tok.Typ == tokStr:
+		return StrVal(tok.Lit), nil
+	case tok.Typ == tokBool:
+		return BoolVal(tok.Lit == "true"), nil
+	case tok.Typ == tokIdent && tok.Lit == "null":
+		return Null, nil
+	case tok.Typ == tokIdent:
+		return Intern(tok.Lit), nil
+	}
+	return nil, fmt.Errorf("expected literal, got %s", tok)
+}
+
+func (p *parser) caseExpr(start Pos) (*caseExpr, error) {
+	p.eatLitOrDie("case")
+	key, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse case: %w", err)
+	}
+	e := &caseExpr{Key: key}
+	for {
+		if tok, _ := p.peek(); tok.Typ == tokRParen {
+			break
+		}
+		if _, err := p.eat(tokLParen); err != nil {
+			return nil, fmt.Errorf("failed to parse case: %w", err)
+		}
+		tok, _ := p.peek()
+		if tok.Typ == tokKeyword && tok.Lit == "else" {
+			body, err := p.elseClause()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse case: %w", err)
+			}
+			e.Else = body
+			continue
+		}
+		var values ListVal
+		if tok.Typ == tokLParen {
+			p.next()
+			for {
+				if tok, _ := p.peek(); tok.Typ == tokRParen {
+					break
+				}
+				val, err := p.literal()
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse case: %w", err)
+				}
+				values = append(values, val)
+			}
+			p.next()
+		} else {
+			val, err := p.literal()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse case: %w", err)
+			}
+			values = ListVal{val}
+		}
+		body, err := p.body()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse case: %w", err)
+		}
+		if _, err := p.eat(tokRParen); err != nil {
+			return nil, fmt.Errorf("failed to parse case: %w", err)
+		}
+		e.Clauses = append(e.Clauses, &caseClause{Values: values, Body: body})
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse case: %w", err)
+	}
+	e.Loc = Span{start, end.Loc.End}
+	return e, nil
+}
+
+func (p *parser) matchExpr(start Pos) (*matchExpr, error) {
+	p.eatLitOrDie("match")
+	subject, err := p.expr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse match: %w", err)
+	}
+	e := &matchExpr{Subject: subject}
+	for {
+		if tok, _ := p.peek(); tok.Typ == tokRParen {
+			break
+		}
+		if _, err := p.eat(tokLParen); err != nil {
+			return nil, fmt.Errorf("failed to parse match: %w", err)
+		}
+		pat, err := p.matchPattern()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse match: %w", err)
+		}
+		body, err := p.body()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse match: %w", err)
+		}
+		if _, err := p.eat(tokRParen); err != nil {
+			return nil, fmt.Errorf("failed to parse match: %w", err)
+		}
+		e.Clauses = append(e.Clauses, &matchClause{Pattern: pat, Body: body})
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse match: %w", err)
+	}
+	e.Loc = Span{start, end.Loc.End}
+	return e, nil
+}
+
+// tryExpr parses a try form. Since catch and finally clauses start with a
+// paren like the expressions of the body, the paren is read before
+// deciding which one follows.
+func (p *parser) tryExpr(start Pos) (*tryExpr, error) {
+	p.eatLitOrDie("try")
+	e := &tryExpr{}
+	var body []expr
+	for {
+		tok, err := p.peek()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse try: %w", err)
+		}
+		if tok.Typ == tokRParen {
+			break
+		}
+		clauses := len(e.Catches) > 0 || e.Finally != nil
+		if tok.Typ != tokLParen {
+			if clauses {
+				return nil, fmt.Errorf("failed to parse try: expected catch or finally, got %s", tok)
+			}
+			expr, err := p.expr()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse try: %w", err)
+			}
+			body = append(body, expr)
+			continue
+		}
+		lparen, _ := p.next()
+		tok, _ = p.peek()
+		switch {
+		case e.Finally != nil:
+			return nil, fmt.Errorf("failed to parse try: unexpected %s after finally", tok)
+		case tok.Typ == tokKeyword && tok.Lit == "catch":
+			clause, err := p.catchClause()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse try: %w", err)
+			}
+			e.Catches = append(e.Catches, clause)
+		case tok.Typ == tokKeyword && tok.Lit == "finally":
+			p.next()
+			if e.Finally, err = p.body(); err != nil {
+				return nil, fmt.Errorf("failed to parse try: %w", err)
+			}
+			if _, err := p.eat(tokRParen); err != nil {
+				return nil, fmt.Errorf("failed to parse try: %w", err)
+			}
+		case clauses:
+			return nil, fmt.Errorf("failed to parse try: expected catch or finally, got %s", tok)
+		default:
+			expr, err := p.form(lparen.Loc.Start)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse try: %w", err)
+			}
+			body = append(body, expr)
+		}
+	}
+	var err error
+	if e.Body, err = p.seq(body); err != nil {
+		return nil, fmt.Errorf("failed to parse try: %w", err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse try: %w", err)
+	}
+	e.Loc = Span{start, end.Loc.End}
+	return e, nil
+}
+
+// catchClause parses the rest of a catch clause whose opening paren has
+// been read.
+func (p *parser) catchClause() (*catchClause, error) {
+	p.eatLitOrDie("catch")
+	clause := &catchClause{}
+	tok, err := p.peek()
+	switch {
+	case err != nil:
+		return nil, err
+	case tok.Typ == tokIdent && tok.Lit == "_":
+		p.next()
+	case tok.Typ == tokIdent && isKeywordArg(tok.Lit):
+		p.next()
+		kind, ok := errorKind(tok.Lit)
+		if !ok {
+			return nil, fmt.Errorf("unknown error kind: %s", tok.Lit)
+		}
+		clause.Kind = kind
+	default:
+		if clause.Pred, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if clause.Name, err = p.identExpr(); err != nil {
+		return nil, err
+	}
+	if clause.Body, err = p.body(); err != nil {
+		return nil, err
+	}
+	if _, err := p.eat(tokRParen); err != nil {
+		return nil, err
+	}
+	return clause, nil
+}
+
+// prefixes maps the tokens that abbreviate a form to the form's name, so
+// that 'x is read as (quote x), `x as (quasiquote x) and so on.
+var prefixes = map[tokType]string{
+	tokQuote:      "quote",
+	tokQuasiquote: "quasiquote",
+	tokUnquote:    "unquote",
+	tokSplice:     "unquote-splicing",
+}
+
+// datum reads a quoted datum and returns it as data.
+func (p *parser) datum() (Value, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok.Typ {
+	case tokLParen:
+		list := ListVal{}
+		for {
+			if tok, _ := p.peek(); tok.Typ == tokRParen {
+				break
+			}
+			elem, err := p.datum()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, elem)
+		}
+		p.next()
+		return list, nil
+	case tokQuote, tokQuasiquote, tokUnquote, tokSplice:
+		quoted, err := p.datum()
+		if err != nil {
+			return nil, err
+		}
+		return ListVal{Intern(prefixes[tok.Typ]), quoted}, nil
+	case tokEOF:
+		return nil, io.EOF
+	}
+	return atom(tok)
+}
+
+// atom returns the datum read from a single token.
+func atom(tok token) (Value, error) {
+	switch tok.Typ {
+	case tokIdent, tokKeyword:
+		if tok.Lit == "null" {
+			return Null, nil
+		}
+		return Intern(tok.Lit), nil
+	case tokNum:
+		return parseNum(tok.Lit)
+	case tokStr:
+		return StrVal(tok.Lit), nil
+	case tokBool:
+		return BoolVal(tok.Lit == "true"), nil
+	}
+	return nil, fmt.Errorf("expected datum, got %s", tok)
+}
+
+// quoteExpr parses 'datum. The (quote datum) form is parsed by
+// quoteForm.
+func (p *parser) quoteExpr() (*quoteExpr, error) {
+	start := p.eatLitOrDie("'").Loc.Start
+	datum, err := p.datum()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quote: %w", err)
+	}
+	return &quoteExpr{datum, Span{start, p.last.Loc.End}}, nil
+}
+
+func (p *parser) quoteForm(start Pos) (*quoteExpr, error) {
+	p.eatLitOrDie("quote")
+	datum, err := p.datum()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quote: %w", err)
+	}
+	end, err := p.eat(tokRParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quote: %w", err)
+	}
+	return &quoteExpr{datum, Span{start, end.Loc.End}}, nil
+}
+
+// quasiExpr parses `template.
+func (p *parser) quasiExpr() (expr, error) {
+	p.eatLitOrDie("`")
+	e, err := p.template(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quasiquote: %w", err)
+	}
+	return e, nil
+}
+
+// template parses a quasiquoted datum nested in depth quasiquotes and
+// returns an expression that builds it. Unquotes are only evaluated at
+// depth 1; deeper ones are kept as data, like the quasiquotes around them.
+func (p *parser) template(depth int) (expr, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	start := tok.Loc.Start
+	switch tok.Typ {
+	case tokUnquote:
+		if depth == 1 {
+			return p.expr()
+		}
+		return p.prefixed(tok, depth-1)
+	case tokSplice:
+		if depth == 1 {
+			return nil, fmt.Errorf("unquote-splicing outside of a list")
+		}
+		return p.prefixed(tok, depth-1)
+	case tokQuasiquote:
+		return p.prefixed(tok, depth+1)
+	case tokQuote:
+		return p.prefixed(tok, depth)
+	case tokLParen:
+		var elems []expr
+		var splice []bool
+		for {
+			next, err := p.peek()
+			if err != nil {
+				return nil, err
+			}
+			if next.Typ == tokRParen {
+				break
+			}
+			var elem expr
+			if next.Typ == tokSplice && depth == 1 {
+				p.next()
+				elem, err = p.expr()
+			} else {
+				elem, err = p.template(depth)
+			}
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+			splice = append(splice, next.Typ == tokSplice && depth == 1)
+		}
+		end, _ := p.next()
+		return build(elems, splice, Span{start, end.Loc.End}), nil
+	}
+	datum, err := atom(tok)
+	if err != nil {
+		return nil, err
+	}
+	return &quoteExpr{datum, tok.Loc}, nil
+}
+
+// prefixed parses the template after a prefix token and builds the form it
+// abbreviates, as in ,x => (unquote x).
+func (p *parser) prefixed(prefix token, depth int) (expr, error) {
+	elem, err := p.template(depth)
+	if err != nil {
+		return nil, err
+	}
+	name := &quoteExpr{Intern(prefixes[prefix.Typ]), prefix.Loc}
+	loc := Span{prefix.Loc.Start, elem.Span().End}
+	return build([]expr{name, elem}, []bool{false, false}, loc), nil
+}
+
+// build returns an expression that builds a list from elems, or a
+// quoteExpr if the elements are all constant.
+func build(elems []expr, splice []bool, loc Span) expr {
+	datum := ListVal{}
+	for i, elem := range elems {
+		quote, ok := elem.(*quoteExpr)
+		if !ok || splice[i] {
+			return &quasiExpr{elems, splice, loc}
+		}
+		datum = append(datum, quote.Datum)
+	}
+	return &quoteExpr{datum, loc}
+}
+
+// isKeywordArg reports whether an identifier names a keyword argument,
+// like :verbose.
+func isKeywordArg(ident string) bool {
+	return len(ident) > 1 && ident[0] == ':'
+}
+
+// keywordExpr parses a keyword argument name, which evaluates to itself
+// as a symbol.
+func (p *parser) keywordExpr() (*quoteExpr, error) {
+	tok, err := p.eat(tokIdent)
+	if err != nil {
+		return nil, err
+	}
+	return &quoteExpr{Intern(tok.Lit), tok.Loc}, nil
+}
+
+func (p *parser) identExpr() (*identExpr, error) {
+	tok, err := p.eat(tokIdent)
+	if err != nil {
+		return nil, err
+	}
+	return &identExpr{Ident: tok.Lit, Loc: tok.Loc}, nil
+}
+
+func (p *parser) numExpr() (*numExpr, error) {
+	tok, err := p.eat(tokNum)
+	if err != nil {
+		return nil, err
+	}
+	num, err := parseNum(tok.Lit)
+	if err != nil {
+		return nil, err
+	}
+	return &numExpr{num, tok.Loc}, nil
+}
+
+func (p *parser) boolExpr() (*boolExpr, error) {
+	tok, err := p.eat(tokBool)
+	if err != nil {
+		return nil, err
+	}
+	return &boolExpr{tok.Lit == "true", tok.Loc}, nil
+}
+
+func (p *parser) strExpr() (*strExpr, error) {
+	tok, err := p.eat(tokStr)
+	if err != nil {
+		return nil, err
+	}
+	return &strExpr{tok.Lit, tok.Loc}, nil
+}
+
+func (p *parser) sExpr() (expr, error) {
+	lparen, err := p.eat(tokLParen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expr: %w", err)
+	}
+	return p.form(lparen.Loc.Start)
+}
+
+// form parses the rest of a parenthesized expression whose opening paren,
+// at start, has been read.
+func (p *parser) form(start Pos) (expr, error) {
+	tok, err := p.peek()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expr: %w", err)
+	}
+	switch tok.Typ {
+	case tokIdent:
+		if p.macros[tok.Lit] {
+			return p.macroExpr(start)
+		}
+		fallthrough
+	case tokLParen:
+		return p.callExpr(start)
+	case tokKeyword:
+		switch tok.Lit {
+		case "fn":
+			return p.funcExpr(start)
+		case "def":
+			return p.defExpr(start)
+		case "defun":
+			return p.defunExpr(start)
+		case "set!":
+			return p.setExpr(start)
+		case "defmacro":
+			return p.defmacroExpr(start)
+		case "if":
+			return p.ifExpr(start)
+		case "seq":
+			return p.seqExpr(start)
+		case "let", "let*", "letrec":
+			return p.letExpr(start)
+		case "cond":
+			return p.condExpr(start)
+		case "when", "unless":
+			return p.whenExpr(start)
+		case "and", "or":
+			return p.logicExpr(start)
+		case "case":
+			return p.caseExpr(start)
+		case "match":
+			return p.matchExpr(start)
+		case "try":
+			return p.tryExpr(start)
+		case "quote":
+			return p.quoteForm(start)
+		}
+	}
+	return nil, fmt.Errorf("failed to parse expr: bad token %s", tok)
+}
+
+func (p *parser) expr() (expr, error) {
+	tok, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch tok.Typ {
+	case tokLParen:
+		return p.sExpr()
+	case tokQuote:
+		return p.quoteExpr()
+	case tokQuasiquote:
+		return p.quasiExpr()
+	case tokUnquote, tokSplice:
+		return nil, fmt.Errorf("failed to parse: %s outside of quasiquote", tok.Lit)
+	case tokIdent:
+		if isKeywordArg(tok.Lit) {
+			return p.keywordExpr()
+		}
+		return p.identExpr()
+	case tokNum:
+		return p.numExpr()
+	case tokStr:
+		return p.strExpr()
+	case tokBool:
+		return p.boolExpr()
+	case tokEOF:
+		return nil, io.EOF
+	}
+	return nil, fmt.Errorf("failed to parse: unknown token %s", tok)
+}
+
+// Parse reads the next top-level expression. It returns io.EOF once the
+// input is exhausted and a *SyntaxError if the input is malformed.
+func (p *parser) Parse() (expr, error) {
+	p.opens = p.opens[:0]
+	expr, err := p.expr()
+	if err != nil && len(p.opens) > 0 && p.last.Typ == tokEOF {
+		// Report the outermost open list rather than the errors of each
+		// form that was cut off.
+		open := p.opens[0]
+		return nil, &SyntaxError{open, unterminatedError{open}}
+	}
+	if err != nil && err != io.EOF {
+		return nil, &SyntaxError{p.last.Loc.Start, err}
+	}
+	return expr, err
+}
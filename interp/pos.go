@@ -0,0 +1,32 @@
+package interp
+
+import (
+	"fmt"
+)
+
+// Pos is a location in a source file. Line and Col are 1-based, Offset is
+// the 0-based byte offset from the start of the file.
+type Pos struct {
+	File   string
+	Line   int
+	Col    int
+	Offset int
+}
+
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// Span is the range of source text [Start, End) covered by a token or
+// an expression.
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+func (s Span) String() string {
+	return s.Start.String()
+}
@@ -0,0 +1,94 @@
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// posSrc spans several lines and has multibyte runes before and inside
+// tokens, so that columns, which count runes, differ from byte offsets.
+const posSrc = `; héllo
+(f "ü" é)
+(let ((ß 1))
+  ß)
+`
+
+func at(line, col, offset int) Pos {
+	return Pos{File: "test", Line: line, Col: col, Offset: offset}
+}
+
+// spanString shows the offsets of a span as well as its lines and columns.
+func spanString(start, end Pos) string {
+	return fmt.Sprintf("%s@%d-%s@%d", start, start.Offset, end, end.Offset)
+}
+
+func TestTokenPositions(t *testing.T) {
+	want := []struct {
+		typ        tokType
+		start, end Pos
+	}{
+		{tokLParen, at(2, 1, 9), at(2, 2, 10)},
+		{tokIdent, at(2, 2, 10), at(2, 3, 11)},
+		{tokStr, at(2, 4, 12), at(2, 7, 16)},
+		{tokIdent, at(2, 8, 17), at(2, 9, 19)},
+		{tokRParen, at(2, 9, 19), at(2, 10, 20)},
+		{tokLParen, at(3, 1, 21), at(3, 2, 22)},
+		{tokKeyword, at(3, 2, 22), at(3, 5, 25)},
+		{tokLParen, at(3, 6, 26), at(3, 7, 27)},
+		{tokLParen, at(3, 7, 27), at(3, 8, 28)},
+		{tokIdent, at(3, 8, 28), at(3, 9, 30)},
+		{tokNum, at(3, 10, 31), at(3, 11, 32)},
+		{tokRParen, at(3, 11, 32), at(3, 12, 33)},
+		{tokRParen, at(3, 12, 33), at(3, 13, 34)},
+		{tokIdent, at(4, 3, 37), at(4, 4, 39)},
+		{tokRParen, at(4, 4, 39), at(4, 5, 40)},
+	}
+	toks := lexAll(t, posSrc)
+	if len(toks) != len(want) {
+		t.Fatalf("got %d tokens, want %d: %v", len(toks), len(want), toks)
+	}
+	for i, tok := range toks {
+		w := want[i]
+		if tok.Typ != w.typ || tok.Loc.Start != w.start || tok.Loc.End != w.end {
+			t.Errorf("token %d (%q): got %v %s, want %v %s",
+				i, tok.Lit, tok.Typ, spanString(tok.Loc.Start, tok.Loc.End), w.typ, spanString(w.start, w.end))
+		}
+	}
+}
+
+func TestExprPositions(t *testing.T) {
+	p := newParser(newLexer("test", bufio.NewReader(strings.NewReader(posSrc))))
+	check := func(what string, got Span, start, end Pos) {
+		t.Helper()
+		if got.Start != start || got.End != end {
+			t.Errorf("%s: got %s, want %s", what, spanString(got.Start, got.End), spanString(start, end))
+		}
+	}
+
+	e, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call, ok := e.(*callExpr)
+	if !ok {
+		t.Fatalf("got %T, want *callExpr", e)
+	}
+	check("call", call.Span(), at(2, 1, 9), at(2, 10, 20))
+	check("call fn", call.Fn.Span(), at(2, 2, 10), at(2, 3, 11))
+	check("call arg 1", call.Args[0].Span(), at(2, 4, 12), at(2, 7, 16))
+	check("call arg 2", call.Args[1].Span(), at(2, 8, 17), at(2, 9, 19))
+
+	e, err = p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	let, ok := e.(*letExpr)
+	if !ok {
+		t.Fatalf("got %T, want *letExpr", e)
+	}
+	check("let", let.Span(), at(3, 1, 21), at(4, 5, 40))
+	check("let init", let.Inits[0].Span(), at(3, 10, 31), at(3, 11, 32))
+	check("let body", let.Body.Span(), at(4, 3, 37), at(4, 4, 39))
+}
@@ -0,0 +1,355 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+var (
+	valueType  = reflect.TypeOf((*Value)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+	bigRatType = reflect.TypeOf((*big.Rat)(nil))
+)
+
+// valTypeOf returns the type of the values that can be converted to the Go
+// type t, or an error if t is not supported.
+func valTypeOf(t reflect.Type) (ValType, error) {
+	if t == valueType {
+		return AnyT, nil
+	}
+	if t.Implements(valueType) {
+		return reflect.Zero(t).Interface().(Value).Type(), nil
+	}
+	if t == bigIntType || t == bigRatType {
+		return NumT, nil
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return NumT, nil
+	case reflect.String:
+		return StrT, nil
+	case reflect.Bool:
+		return BoolT, nil
+	case reflect.Slice:
+		if _, err := valTypeOf(t.Elem()); err != nil {
+			return 0, err
+		}
+		return ListT, nil
+	case reflect.Map:
+		if _, err := valTypeOf(t.Key()); err != nil {
+			return 0, err
+		}
+		if _, err := valTypeOf(t.Elem()); err != nil {
+			return 0, err
+		}
+		return MapT, nil
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return AnyT, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported type %s", t)
+}
+
+// fromValue converts val to the Go type t.
+func fromValue(val Value, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		if x := toGo(val); x != nil {
+			return reflect.ValueOf(x), nil
+		}
+		return reflect.Zero(t), nil
+	}
+	if reflect.TypeOf(val).AssignableTo(t) {
+		return reflect.ValueOf(val), nil
+	}
+	if t.Implements(valueType) {
+		return reflect.Value{}, fmt.Errorf("must be %s, got %s", t.Name(), reflect.TypeOf(val).Name())
+	}
+	typ, _ := valTypeOf(t)
+	if val.Type() != typ {
+		return reflect.Value{}, fmt.Errorf("must be %s, got %s", typ, val.Type())
+	}
+	rv := reflect.New(t).Elem()
+	switch t {
+	case bigIntType:
+		if !isInteger(val) {
+			return rv, fmt.Errorf("must be an integer, got %s", val)
+		}
+		return reflect.ValueOf(new(big.Int).Set(toBig(val))), nil
+	case bigRatType:
+		if levelOf(val) == floatLevel {
+			return rv, fmt.Errorf("must be exact, got %s", val)
+		}
+		return reflect.ValueOf(new(big.Rat).Set(toRat(val))), nil
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := intArg(val, t)
+		if err != nil {
+			return rv, err
+		}
+		if rv.OverflowInt(n) {
+			return rv, fmt.Errorf("must fit in %s, got %d", t, n)
+		}
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := intArg(val, t)
+		if err != nil {
+			return rv, err
+		}
+		if n < 0 || rv.OverflowUint(uint64(n)) {
+			return rv, fmt.Errorf("must fit in %s, got %d", t, n)
+		}
+		rv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		f := toFloat(val)
+		if rv.OverflowFloat(f) {
+			return rv, fmt.Errorf("must fit in %s, got %s", t, val)
+		}
+		rv.SetFloat(f)
+	case reflect.String:
+		rv.SetString(string(val.(StrVal)))
+	case reflect.Bool:
+		rv.SetBool(bool(val.(BoolVal)))
+	case reflect.Slice:
+		list := val.(ListVal)
+		rv.Set(reflect.MakeSlice(t, len(list), len(list)))
+		for i, elem := range list {
+			ev, err := fromValue(elem, t.Elem())
+			if err != nil {
+				return rv, fmt.Errorf("element %d %s", i+1, err)
+			}
+			rv.Index(i).Set(ev)
+		}
+	case reflect.Map:
+		rv.Set(reflect.MakeMap(t))
+		for key, elem := range val.(MapVal) {
+			kv, err := fromValue(key, t.Key())
+			if err != nil {
+				return rv, fmt.Errorf("key %s %s", key, err)
+			}
+			ev, err := fromValue(elem, t.Elem())
+			if err != nil {
+				return rv, fmt.Errorf("element %s %s", key, err)
+			}
+			rv.SetMapIndex(kv, ev)
+		}
+	}
+	return rv, nil
+}
+
+// intArg returns the integer val for conversion to t.
+func intArg(val Value, t reflect.Type) (int64, error) {
+	switch val := val.(type) {
+	case NumVal:
+		return int64(val), nil
+	case BigIntVal:
+		return 0, fmt.Errorf("must fit in %s, got %s", t, val)
+	}
+	return 0, fmt.Errorf("must be an integer, got %s", val)
+}
+
+// toGo converts val to the natural Go representation for an interface{}.
+func toGo(val Value) interface{} {
+	switch val := val.(type) {
+	case NumVal:
+		return int(val)
+	case BigIntVal:
+		return val.Value()
+	case RatVal:
+		return val.Value()
+	case FloatVal:
+		return float64(val)
+	case StrVal:
+		return string(val)
+	case BoolVal:
+		return bool(val)
+	case NullVal:
+		return nil
+	case ListVal:
+		elems := make([]interface{}, len(val))
+		for i, elem := range val {
+			elems[i] = toGo(elem)
+		}
+		return elems
+	case MapVal:
+		m := make(map[interface{}]interface{}, len(val))
+		for key, elem := range val {
+			m[toGo(key)] = toGo(elem)
+		}
+		return m
+	}
+	return val
+}
+
+// ToValue converts a Go value to a Value. It supports integers, strings,
+// bools, floats, *big.Int, *big.Rat, slices, maps and Values.
+func ToValue(x interface{}) (Value, error) {
+	return toValue(reflect.ValueOf(x))
+}
+
+func toValue(rv reflect.Value) (Value, error) {
+	if !rv.IsValid() {
+		return Null, nil
+	}
+	if rv.Type().Implements(valueType) {
+		if rv.Kind() == reflect.Interface && rv.IsNil() {
+			return Null, nil
+		}
+		return rv.Interface().(Value), nil
+	}
+	switch rv.Type() {
+	case bigIntType:
+		if rv.IsNil() {
+			return Null, nil
+		}
+		return normInt(new(big.Int).Set(rv.Interface().(*big.Int))), nil
+	case bigRatType:
+		if rv.IsNil() {
+			return Null, nil
+		}
+		return normRat(new(big.Rat).Set(rv.Interface().(*big.Rat))), nil
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NumVal(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return normInt(new(big.Int).SetUint64(rv.Uint())), nil
+		}
+		return normInt(big.NewInt(int64(rv.Uint()))), nil
+	case reflect.Float32, reflect.Float64:
+		return FloatVal(rv.Float()), nil
+	case reflect.String:
+		return StrVal(rv.String()), nil
+	case reflect.Bool:
+		return BoolVal(rv.Bool()), nil
+	case reflect.Slice, reflect.Array:
+		list := make(ListVal, rv.Len())
+		for i := range list {
+			elem, err := toValue(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = elem
+		}
+		return list, nil
+	case reflect.Map:
+		m := make(MapVal, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := toValue(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if !isKey(key) {
+				return nil, fmt.Errorf("bad map key: %s", key)
+			}
+			elem, err := toValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			m[key] = elem
+		}
+		return m, nil
+	case reflect.Interface, reflect.Ptr:
+		if rv.IsNil() {
+			return Null, nil
+		}
+		return toValue(rv.Elem())
+	}
+	return nil, fmt.Errorf("unsupported type %s", rv.Type())
+}
+
+// callGo calls fv, reporting a panic in the Go function as a runtime error
+// rather than letting it unwind through the interpreter.
+func callGo(name string, fv reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newError(EvalErr, "%s: panic: %v", name, r)
+		}
+	}()
+	return fv.Call(in), nil
+}
+
+// GoFunc wraps a Go function as a builtin. The function's parameters and
+// results may be integers, strings, bools, slices, maps, Values or
+// interface{}, and it may be variadic. It may return at most one value,
+// optionally followed by an error, which is reported as a runtime error.
+// Arguments are converted when the function is called, and arguments of
+// the wrong type or number are reported as type and arity errors.
+func GoFunc(name string, fn interface{}) (BuiltInFuncVal, error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return BuiltInFuncVal{}, fmt.Errorf("%s: not a function: %T", name, fn)
+	}
+	t := fv.Type()
+	var params []ValType
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		typ, err := valTypeOf(in)
+		if err != nil {
+			return BuiltInFuncVal{}, fmt.Errorf("%s: parameter %d: %w", name, i+1, err)
+		}
+		params = append(params, typ)
+	}
+	results := t.NumOut()
+	returnsErr := results > 0 && t.Out(results-1) == errorType
+	if returnsErr {
+		results--
+	}
+	if results > 1 {
+		return BuiltInFuncVal{}, fmt.Errorf("%s: too many results", name)
+	}
+	if results == 1 {
+		if _, err := valTypeOf(t.Out(0)); err != nil {
+			return BuiltInFuncVal{}, fmt.Errorf("%s: result: %w", name, err)
+		}
+	}
+
+	f := func(args ...Value) (Value, error) {
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var typ reflect.Type
+			if t.IsVariadic() && i >= t.NumIn()-1 {
+				typ = t.In(t.NumIn() - 1).Elem()
+			} else {
+				typ = t.In(i)
+			}
+			rv, err := fromValue(arg, typ)
+			if err != nil {
+				return nil, newError(TypeErr, "%s: argument %d %s", name, i+1, err)
+			}
+			in[i] = rv
+		}
+		out, err := callGo(name, fv, in)
+		if err != nil {
+			return nil, err
+		}
+		if returnsErr {
+			if err := out[len(out)-1]; !err.IsNil() {
+				if rerr, ok := err.Interface().(*RuntimeError); ok {
+					return nil, rerr
+				}
+				return nil, &RuntimeError{Kind: EvalErr, Err: err.Interface().(error)}
+			}
+		}
+		if results == 0 {
+			return Null, nil
+		}
+		val, err := toValue(out[0])
+		if err != nil {
+			return nil, newError(TypeErr, "%s: result %s", name, err)
+		}
+		return val, nil
+	}
+	return BuiltInFuncVal{name: name, params: params, variadic: t.IsVariadic(), f: f}, nil
+}
@@ -0,0 +1,173 @@
+package interp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestGoFuncConversions(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		must(t, in.DefineFunc("add", func(a, b int) int { return a + b }))
+		must(t, in.DefineFunc("half", func(x float64) float64 { return x / 2 }))
+		must(t, in.DefineFunc("shout", func(s string) string { return strings.ToUpper(s) + "!" }))
+		must(t, in.DefineFunc("flip", func(b bool) bool { return !b }))
+		must(t, in.DefineFunc("double-all", func(xs []int) []int {
+			out := make([]int, len(xs))
+			for i, x := range xs {
+				out[i] = 2 * x
+			}
+			return out
+		}))
+		must(t, in.DefineFunc("lengths", func(m map[string][]string) map[string]int {
+			out := make(map[string]int)
+			for k, v := range m {
+				out[k] = len(v)
+			}
+			return out
+		}))
+		must(t, in.DefineFunc("words", func() map[string][]string {
+			return map[string][]string{"a": {"x", "y"}, "b": nil}
+		}))
+		must(t, in.DefineFunc("sum", func(xs ...int) int {
+			n := 0
+			for _, x := range xs {
+				n += x
+			}
+			return n
+		}))
+		must(t, in.DefineFunc("join", func(sep string, parts ...string) string {
+			return strings.Join(parts, sep)
+		}))
+		must(t, in.DefineFunc("byte-of", func(b uint8) uint8 { return b }))
+		must(t, in.DefineFunc("small", func(b int8) int8 { return b }))
+		must(t, in.DefineFunc("square", func(x *big.Int) *big.Int { return new(big.Int).Mul(x, x) }))
+		must(t, in.DefineFunc("max-uint", func() uint64 { return 1<<64 - 1 }))
+		evalTests{
+			{"(add 2 3)", "5"},
+			{"(half 3)", "1.5"},
+			{"(half 1/2)", "0.25"},
+			{`(shout "hi")`, "HI!"},
+			{"(flip #t)", "false"},
+			{"(double-all (list 1 2 3))", "[2, 4, 6]"},
+			{"(double-all '())", "[]"},
+			{"(words)", "{a: [x, y], b: []}"},
+			{"(lengths (words))", "{a: 2, b: 0}"},
+			{"(sum)", "0"},
+			{"(sum 1 2 3)", "6"},
+			{`(join "-" "a" "b" "c")`, "a-b-c"},
+			{"(byte-of 255)", "255"},
+			{"(small -128)", "-128"},
+			{"(square 100000000000)", "10000000000000000000000"},
+			{"(square 3)", "9"},
+			{"(max-uint)", "18446744073709551615"},
+			{"(try (byte-of 256) (catch :type e (error-message e)))", "byte-of: argument 1 must fit in uint8, got 256"},
+			{"(try (byte-of -1) (catch :type e (error-message e)))", "byte-of: argument 1 must fit in uint8, got -1"},
+			{"(try (small 128) (catch :type e (error-message e)))", "small: argument 1 must fit in int8, got 128"},
+			{"(try (add 1 1.5) (catch :type e (error-message e)))", "add: argument 2 must be an integer, got 1.5"},
+			{"(try (square 1/2) (catch :type e (error-message e)))", "square: argument 1 must be an integer, got 1/2"},
+			{`(try (add 1 "2") (catch :type e 'type))`, "type"},
+			{`(try (sum 1 "2") (catch :type e 'type))`, "type"},
+			{"(try (double-all (list 1 #t)) (catch :type e 'type))", "type"},
+			{"(try (add 1) (catch :arity e 'arity))", "arity"},
+			{"(try (add 1 2 3) (catch :arity e 'arity))", "arity"},
+			{"(try (join) (catch :arity e 'arity))", "arity"},
+		}.run(t, in)
+	})
+}
+
+func TestGoFuncErrors(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		must(t, in.DefineFunc("check", func(n int) (int, error) {
+			if n < 0 {
+				return 0, fmt.Errorf("negative: %d", n)
+			}
+			return n, nil
+		}))
+		must(t, in.DefineFunc("fail", func() error { return errors.New("failed") }))
+		evalTests{
+			{"(check 1)", "1"},
+			{"(try (check -1) (catch :eval e (error-message e)))", "negative: -1"},
+			{"(try (fail) (catch _ e (error-kind e)))", ":eval"},
+		}.run(t, in)
+	})
+}
+
+func TestGoFuncBadSignatures(t *testing.T) {
+	for _, fn := range []interface{}{
+		42,
+		func(c chan int) {},
+		func() (int, int) { return 0, 0 },
+		func() (chan int, error) { return nil, nil },
+	} {
+		if _, err := GoFunc("f", fn); err == nil {
+			t.Errorf("GoFunc(%T): got no error", fn)
+		}
+	}
+}
+
+func TestToValue(t *testing.T) {
+	for _, tc := range []struct {
+		x    interface{}
+		want string
+	}{
+		{nil, "null"},
+		{3, "3"},
+		{int8(-3), "-3"},
+		{uint64(1 << 63), "9223372036854775808"},
+		{2.5, "2.5"},
+		{"s", "s"},
+		{true, "true"},
+		{[]string{"a", "b"}, "[a, b]"},
+		{map[int]bool{1: true}, "{1: true}"},
+		{big.NewInt(7), "7"},
+		{big.NewRat(1, 3), "1/3"},
+		{StrVal("v"), "v"},
+	} {
+		got, err := ToValue(tc.x)
+		if err != nil {
+			t.Errorf("ToValue(%#v): %s", tc.x, err)
+			continue
+		}
+		if got.String() != tc.want {
+			t.Errorf("ToValue(%#v): got %s, want %s", tc.x, got, tc.want)
+		}
+	}
+	if _, err := ToValue(make(chan int)); err == nil {
+		t.Errorf("ToValue(chan): got no error")
+	}
+}
+
+func TestGoFuncNull(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		must(t, in.DefineFunc("id", func(x interface{}) interface{} { return x }))
+		must(t, in.DefineFunc("lens", func(xs []interface{}) int { return len(xs) }))
+		evalTests{
+			{"(id null)", "null"},
+			{"(lens (list 1 null))", "2"},
+		}.run(t, in)
+	})
+}
+
+func TestGoFuncPanic(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		must(t, in.DefineFunc("boom", func() { panic("oops") }))
+		evalTests{
+			{"(try (boom) (catch :eval e (error-message e)))", "boom: panic: oops"},
+		}.run(t, in)
+		_, err := in.EvalString("(boom)")
+		if err == nil || !strings.Contains(err.Error(), "boom: panic: oops") {
+			t.Errorf("got %v, want a panic error", err)
+		}
+	})
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
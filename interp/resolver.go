@@ -0,0 +1,553 @@
+package interp
+
+import (
+	"fmt"
+)
+
+type varRefKind int
+
+const (
+	localRef    varRefKind = iota + 1 // bound by the innermost lambda
+	capturedRef                       // bound by an enclosing lambda
+	globalRef                         // defined at the top level
+	builtinRef                        // a builtin that is not shadowed by a global
+)
+
+func (kind varRefKind) String() string {
+	switch kind {
+	case localRef:
+		return "local"
+	case capturedRef:
+		return "captured"
+	case globalRef:
+		return "global"
+	case builtinRef:
+		return "builtin"
+	}
+	return "unresolved"
+}
+
+// varRef is the address of a name as determined by the resolver. Local and
+// captured names live in slot Slot of the frame Depth levels up from the
+// current one; builtins live in slot Slot of builtinTable; globals are
+// looked up by name.
+type varRef struct {
+	Kind  varRefKind
+	Depth int
+	Slot  int
+}
+
+// scope maps the names bound by a lambda (its params and the names it
+// defines with def and defun) to slots in its frame.
+type scope struct {
+	slots  map[string]int
+	locals []string
+	up     *scope
+}
+
+func newScope(up *scope) *scope {
+	return &scope{slots: make(map[string]int), up: up}
+}
+
+// declare returns the slot for name, allocating one if needed.
+func (s *scope) declare(name string) int {
+	if slot, ok := s.slots[name]; ok {
+		return slot
+	}
+	s.locals = append(s.locals, name)
+	s.slots[name] = len(s.locals) - 1
+	return len(s.locals) - 1
+}
+
+// resolve returns the number of scopes between s and the one that binds
+// name, and the slot of name in that scope.
+func (s *scope) resolve(name string) (int, int, bool) {
+	depth := 0
+	for cur := s; cur != nil; cur = cur.up {
+		if slot, ok := cur.slots[name]; ok {
+			return depth, slot, true
+		}
+		depth++
+	}
+	return 0, 0, false
+}
+
+// definedNames returns the names defined by def and defun in e, not
+// counting those inside nested lambdas or let frames.
+func definedNames(e expr) []string {
+	var names []string
+	switch e := e.(type) {
+	case *defExpr:
+		names = append(definedNames(e.Binding), e.Name)
+	case *defunExpr:
+		names = append(names, e.Name)
+	case *setExpr:
+		names = definedNames(e.Value)
+	case *macroExpr:
+		if e.Expansion != nil {
+			names = definedNames(e.Expansion)
+		}
+	case *callExpr:
+		names = definedNames(e.Fn)
+		for _, arg := range e.Args {
+			names = append(names, definedNames(arg)...)
+		}
+	case *ifExpr:
+		names = append(names, definedNames(e.Antecedent)...)
+		names = append(names, definedNames(e.Consequent)...)
+		names = append(names, definedNames(e.Alternate)...)
+	case *seqExpr:
+		for _, expr := range e.Body {
+			names = append(names, definedNames(expr)...)
+		}
+	case *letExpr:
+		// Only the inits of a plain let are outside of its frame.
+		if e.Kind == letPlain {
+			for _, init := range e.Inits {
+				names = append(names, definedNames(init)...)
+			}
+		}
+	case *condExpr:
+		for _, clause := range e.Clauses {
+			names = append(names, definedNames(clause.Test)...)
+			names = append(names, definedNames(clause.Body)...)
+		}
+		if e.Else != nil {
+			names = append(names, definedNames(e.Else)...)
+		}
+	case *whenExpr:
+		names = append(names, definedNames(e.Test)...)
+		names = append(names, definedNames(e.Body)...)
+	case *logicExpr:
+		for _, arg := range e.Args {
+			names = append(names, definedNames(arg)...)
+		}
+	case *quasiExpr:
+		for _, elem := range e.Elems {
+			names = append(names, definedNames(elem)...)
+		}
+	case *matchExpr:
+		// The clauses are inside the frames that bind their patterns.
+		names = definedNames(e.Subject)
+	case *tryExpr:
+		// The catch bodies are inside the frames that bind their names.
+		names = definedNames(e.Body)
+		for _, clause := range e.Catches {
+			if clause.Pred != nil {
+				names = append(names, definedNames(clause.Pred)...)
+			}
+		}
+		if e.Finally != nil {
+			names = append(names, definedNames(e.Finally)...)
+		}
+	case *caseExpr:
+		names = definedNames(e.Key)
+		for _, clause := range e.Clauses {
+			names = append(names, definedNames(clause.Body)...)
+		}
+		if e.Else != nil {
+			names = append(names, definedNames(e.Else)...)
+		}
+	}
+	return names
+}
+
+// resolver annotates every name in a program with its varRef and reports
+// undefined names and duplicate parameters. Definitions are visible
+// throughout the lambda (or program) that contains them, so functions may
+// refer to functions defined after them.
+type resolver struct {
+	globals map[string]bool
+	scope   *scope // nil at the top level
+
+	// If AllowUndefined is set, names that are not defined anywhere are
+	// resolved as globals, and only reported if they are still undefined
+	// when evaluated.
+	AllowUndefined bool
+}
+
+func newResolver() resolver {
+	return resolver{globals: make(map[string]bool)}
+}
+
+// resolve resolves a sequence of top-level expressions. Globals defined by
+// earlier calls remain visible.
+func (r *resolver) resolve(exprs ...expr) error {
+	r.declareDefined(exprs...)
+	for _, e := range exprs {
+		if err := e.visit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declareDefined declares the globals that exprs define, so that they may
+// be referred to before the expressions that define them are resolved.
+func (r *resolver) declareDefined(exprs ...expr) {
+	for _, e := range exprs {
+		for _, name := range definedNames(e) {
+			r.globals[name] = true
+		}
+	}
+}
+
+// declareGlobal makes a global defined outside of the program visible to it.
+func (r *resolver) declareGlobal(name string) {
+	r.globals[name] = true
+}
+
+func (r *resolver) errorf(e expr, format string, args ...interface{}) error {
+	return &SyntaxError{e.Span().Start, fmt.Errorf(format, args...)}
+}
+
+// define returns the varRef for a definition of name in the current scope.
+func (r *resolver) define(name string) varRef {
+	if r.scope == nil {
+		return varRef{Kind: globalRef}
+	}
+	return varRef{Kind: localRef, Slot: r.scope.declare(name)}
+}
+
+// declare binds names to slots in scope. If a name appears twice, it is
+// reported as a duplicate of the kind described by what.
+func (r *resolver) declare(scope *scope, names []*identExpr, what string) error {
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name.Ident] {
+			return r.errorf(name, "%s: %s", what, name.Ident)
+		}
+		seen[name.Ident] = true
+	}
+	for _, name := range names {
+		name.Ref = varRef{Kind: localRef, Slot: scope.declare(name.Ident)}
+	}
+	return nil
+}
+
+// lambda resolves the defaults and body of a lambda in a new scope and
+// returns the names of its frame slots.
+func (r *resolver) lambda(params *paramList, body expr) ([]string, error) {
+	scope := newScope(r.scope)
+	if err := r.declare(scope, params.Names(), "duplicate parameter"); err != nil {
+		return nil, err
+	}
+	for _, name := range definedNames(body) {
+		scope.declare(name)
+	}
+	r.scope = scope
+	defer func() {
+		r.scope = scope.up
+	}()
+	for _, opt := range params.Defaults() {
+		if opt.Default == nil {
+			continue
+		}
+		if err := opt.Default.visit(r); err != nil {
+			return nil, err
+		}
+	}
+	err := body.visit(r)
+	return scope.locals, err
+}
+
+func (r *resolver) visitCall(e *callExpr) error {
+	if err := e.Fn.visit(r); err != nil {
+		return err
+	}
+	for _, arg := range e.Args {
+		if err := arg.visit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resolver) visitFunc(e *funcExpr) error {
+	locals, err := r.lambda(e.Params, e.Body)
+	e.Locals = locals
+	return err
+}
+
+func (r *resolver) visitDef(e *defExpr) error {
+	if err := e.Binding.visit(r); err != nil {
+		return err
+	}
+	e.Ref = r.define(e.Name)
+	return nil
+}
+
+func (r *resolver) visitDefun(e *defunExpr) error {
+	e.Ref = r.define(e.Name)
+	locals, err := r.lambda(e.Params, e.Body)
+	e.Locals = locals
+	return err
+}
+
+// visitSet resolves the name like a reference to it, since set! assigns
+// to an existing variable. Builtins can't be assigned to.
+func (r *resolver) visitSet(e *setExpr) error {
+	if err := e.Value.visit(r); err != nil {
+		return err
+	}
+	if e.Name.Ident == "null" {
+		return r.errorf(e.Name, "can't set null")
+	}
+	if err := e.Name.visit(r); err != nil {
+		return err
+	}
+	if e.Name.Ref.Kind == builtinRef {
+		return r.errorf(e.Name, "can't set builtin: %s", e.Name.Ident)
+	}
+	return nil
+}
+
+// visitDefmacro does nothing, since the transformer was resolved when the
+// macro was defined.
+func (r *resolver) visitDefmacro(e *defmacroExpr) error {
+	return nil
+}
+
+func (r *resolver) visitMacro(e *macroExpr) error {
+	if e.Expansion == nil {
+		return r.errorf(e, "unexpanded macro: %s", e.Name)
+	}
+	return e.Expansion.visit(r)
+}
+
+func (r *resolver) visitIf(e *ifExpr) error {
+	if err := e.Antecedent.visit(r); err != nil {
+		return err
+	}
+	if err := e.Consequent.visit(r); err != nil {
+		return err
+	}
+	return e.Alternate.visit(r)
+}
+
+func (r *resolver) visitSeq(e *seqExpr) error {
+	for _, expr := range e.Body {
+		if err := expr.visit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resolver) visitLet(e *letExpr) error {
+	if e.Kind == letPlain {
+		for _, init := range e.Inits {
+			if err := init.visit(r); err != nil {
+				return err
+			}
+		}
+	}
+	scope := newScope(r.scope)
+	if e.Kind != letStar {
+		var names []*identExpr
+		for _, pat := range e.Patterns {
+			names = append(names, pat.Names()...)
+		}
+		if err := r.declare(scope, names, "duplicate binding in "+e.Kind.String()); err != nil {
+			return err
+		}
+	}
+	r.scope = scope
+	defer func() {
+		r.scope = scope.up
+	}()
+	for i, pat := range e.Patterns {
+		switch e.Kind {
+		case letStar:
+			// A later binding of the same name reuses its slot, which
+			// still holds the earlier value while the init is evaluated.
+			if err := e.Inits[i].visit(r); err != nil {
+				return err
+			}
+			if err := r.declare(scope, pat.Names(), "duplicate binding in let*"); err != nil {
+				return err
+			}
+		case letRec:
+			if err := e.Inits[i].visit(r); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range definedNames(e.Body) {
+		scope.declare(name)
+	}
+	err := e.Body.visit(r)
+	e.Locals = scope.locals
+	return err
+}
+
+func (r *resolver) visitCond(e *condExpr) error {
+	for _, clause := range e.Clauses {
+		if err := clause.Test.visit(r); err != nil {
+			return err
+		}
+		if err := clause.Body.visit(r); err != nil {
+			return err
+		}
+	}
+	if e.Else != nil {
+		return e.Else.visit(r)
+	}
+	return nil
+}
+
+func (r *resolver) visitWhen(e *whenExpr) error {
+	if err := e.Test.visit(r); err != nil {
+		return err
+	}
+	return e.Body.visit(r)
+}
+
+func (r *resolver) visitLogic(e *logicExpr) error {
+	for _, arg := range e.Args {
+		if err := arg.visit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resolver) visitCase(e *caseExpr) error {
+	if err := e.Key.visit(r); err != nil {
+		return err
+	}
+	for _, clause := range e.Clauses {
+		if err := clause.Body.visit(r); err != nil {
+			return err
+		}
+	}
+	if e.Else != nil {
+		return e.Else.visit(r)
+	}
+	return nil
+}
+
+func (r *resolver) visitMatch(e *matchExpr) error {
+	if err := e.Subject.visit(r); err != nil {
+		return err
+	}
+	for _, clause := range e.Clauses {
+		if err := r.matchClause(clause); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchClause resolves the predicates and body of a match clause in a new
+// scope binding the names in its pattern.
+func (r *resolver) matchClause(clause *matchClause) error {
+	scope := newScope(r.scope)
+	if err := r.declare(scope, clause.Pattern.Names(), "duplicate binding in match"); err != nil {
+		return err
+	}
+	r.scope = scope
+	defer func() {
+		r.scope = scope.up
+	}()
+	for _, pred := range clause.Pattern.Preds() {
+		if err := pred.visit(r); err != nil {
+			return err
+		}
+	}
+	for _, name := range definedNames(clause.Body) {
+		scope.declare(name)
+	}
+	err := clause.Body.visit(r)
+	clause.Locals = scope.locals
+	return err
+}
+
+func (r *resolver) visitTry(e *tryExpr) error {
+	if err := e.Body.visit(r); err != nil {
+		return err
+	}
+	for _, clause := range e.Catches {
+		if clause.Pred != nil {
+			if err := clause.Pred.visit(r); err != nil {
+				return err
+			}
+		}
+		if err := r.catchClause(clause); err != nil {
+			return err
+		}
+	}
+	if e.Finally != nil {
+		return e.Finally.visit(r)
+	}
+	return nil
+}
+
+// catchClause resolves the body of a catch clause in a new scope binding
+// the name of the error.
+func (r *resolver) catchClause(clause *catchClause) error {
+	scope := newScope(r.scope)
+	clause.Name.Ref = varRef{Kind: localRef, Slot: scope.declare(clause.Name.Ident)}
+	for _, name := range definedNames(clause.Body) {
+		scope.declare(name)
+	}
+	r.scope = scope
+	defer func() {
+		r.scope = scope.up
+	}()
+	err := clause.Body.visit(r)
+	clause.Locals = scope.locals
+	return err
+}
+
+func (r *resolver) visitQuote(e *quoteExpr) error {
+	return nil
+}
+
+func (r *resolver) visitQuasi(e *quasiExpr) error {
+	for _, elem := range e.Elems {
+		if err := elem.visit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *resolver) visitIdent(e *identExpr) error {
+	if e.Ident == "null" {
+		return nil
+	}
+	if depth, slot, ok := r.scope.resolve(e.Ident); ok {
+		kind := localRef
+		if depth > 0 {
+			kind = capturedRef
+		}
+		e.Ref = varRef{kind, depth, slot}
+		return nil
+	}
+	if r.globals[e.Ident] {
+		e.Ref = varRef{Kind: globalRef}
+		return nil
+	}
+	if slot, ok := builtinSlots[e.Ident]; ok {
+		e.Ref = varRef{Kind: builtinRef, Slot: slot}
+		return nil
+	}
+	if r.AllowUndefined {
+		e.Ref = varRef{Kind: globalRef}
+		return nil
+	}
+	return r.errorf(e, "undefined: %s", e.Ident)
+}
+
+func (r *resolver) visitNum(e *numExpr) error {
+	return nil
+}
+
+func (r *resolver) visitBool(e *boolExpr) error {
+	return nil
+}
+
+func (r *resolver) visitStr(e *strExpr) error {
+	return nil
+}
@@ -0,0 +1,434 @@
+package interp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type ValType int
+
+const (
+	NumT ValType = iota + 1
+	StrT
+	FuncT
+	ListT
+	BoolT
+	NullT
+	MapT
+	SymT
+	BoxT
+	ErrorT
+)
+
+// AnyT is accepted in builtin signatures for parameters of any type.
+const AnyT ValType = 0
+
+func (typ ValType) String() string {
+	switch typ {
+	case AnyT:
+		return "any"
+	case NumT:
+		return "num"
+	case StrT:
+		return "str"
+	case FuncT:
+		return "func"
+	case ListT:
+		return "list"
+	case BoolT:
+		return "bool"
+	case NullT:
+		return "null"
+	case MapT:
+		return "map"
+	case SymT:
+		return "symbol"
+	case BoxT:
+		return "box"
+	case ErrorT:
+		return "error"
+	}
+	return ""
+}
+
+type Value interface {
+	Type() ValType
+	fmt.Stringer
+}
+
+type NullVal struct{}
+
+func (NullVal) Type() ValType {
+	return NullT
+}
+
+func (NullVal) String() string {
+	return "null"
+}
+
+var Null = NullVal{}
+
+type NumVal int
+
+func (NumVal) Type() ValType {
+	return NumT
+}
+
+func (v NumVal) Value() int {
+	return int(v)
+}
+
+func (v NumVal) String() string {
+	return fmt.Sprintf("%d", v.Value())
+}
+
+type StrVal string
+
+func (StrVal) Type() ValType {
+	return StrT
+}
+
+func (s StrVal) Value() string {
+	return string(s)
+}
+
+func (s StrVal) String() string {
+	return s.Value()
+}
+
+// SymVal is a symbol. Symbols are interned, so symbols with the same name
+// are equal under ==.
+type SymVal struct {
+	name *string
+}
+
+var symbols = struct {
+	sync.Mutex
+	table map[string]SymVal
+}{table: make(map[string]SymVal)}
+
+// Intern returns the symbol with the given name.
+func Intern(name string) SymVal {
+	symbols.Lock()
+	defer symbols.Unlock()
+	sym, ok := symbols.table[name]
+	if !ok {
+		sym = SymVal{&name}
+		symbols.table[name] = sym
+	}
+	return sym
+}
+
+func (SymVal) Type() ValType {
+	return SymT
+}
+
+func (s SymVal) Value() string {
+	return *s.name
+}
+
+func (s SymVal) String() string {
+	return s.Value()
+}
+
+// BoxVal is a mutable cell holding a value. Copies of a box share the
+// cell, so a box can be used to share state between closures.
+type BoxVal struct {
+	val *Value
+}
+
+// NewBox returns a box holding val.
+func NewBox(val Value) BoxVal {
+	return BoxVal{&val}
+}
+
+func (BoxVal) Type() ValType {
+	return BoxT
+}
+
+func (b BoxVal) Value() Value {
+	return *b.val
+}
+
+// Set replaces the value held by b.
+func (b BoxVal) Set(val Value) {
+	*b.val = val
+}
+
+func (b BoxVal) String() string {
+	return "box(" + b.Value().String() + ")"
+}
+
+// ErrorVal is an error caught by try, or raised by throw. It is shared
+// with the RuntimeError it wraps, so throwing it again reports the error
+// where it first happened.
+type ErrorVal struct {
+	err *RuntimeError
+}
+
+func (ErrorVal) Type() ValType {
+	return ErrorT
+}
+
+func (e ErrorVal) Value() *RuntimeError {
+	return e.err
+}
+
+// Kind returns the kind of the error.
+func (e ErrorVal) Kind() ErrorKind {
+	return e.err.Kind
+}
+
+// Message returns the message of the error, without its location.
+func (e ErrorVal) Message() string {
+	return e.err.Err.Error()
+}
+
+// Payload returns the value given to throw or error, or null if the
+// interpreter raised the error.
+func (e ErrorVal) Payload() Value {
+	if e.err.Payload == nil {
+		return Null
+	}
+	return e.err.Payload
+}
+
+func (e ErrorVal) String() string {
+	return fmt.Sprintf("error(%s: %s)", kindNames[e.err.Kind], e.Message())
+}
+
+type ListVal []Value
+
+func (ListVal) Type() ValType {
+	return ListT
+}
+
+func (l ListVal) Value() []Value {
+	return []Value(l)
+}
+
+func (l ListVal) String() string {
+	var elems []string
+	for _, elem := range l.Value() {
+		elems = append(elems, elem.String())
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// MapVal maps ints, floats, strings, bools and symbols to values.
+type MapVal map[Value]Value
+
+func (MapVal) Type() ValType {
+	return MapT
+}
+
+func (m MapVal) Value() map[Value]Value {
+	return map[Value]Value(m)
+}
+
+func (m MapVal) String() string {
+	var elems []string
+	for key, val := range m.Value() {
+		elems = append(elems, key.String()+": "+val.String())
+	}
+	sort.Strings(elems)
+	return "{" + strings.Join(elems, ", ") + "}"
+}
+
+// Repr formats val like String, except that strings, including those in
+// lists and maps, are quoted and escaped as they would be in a program.
+func Repr(val Value) string {
+	switch v := val.(type) {
+	case StrVal:
+		return quote(string(v))
+	case ListVal:
+		var elems []string
+		for _, elem := range v {
+			elems = append(elems, Repr(elem))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case MapVal:
+		var elems []string
+		for key, elem := range v {
+			elems = append(elems, Repr(key)+": "+Repr(elem))
+		}
+		sort.Strings(elems)
+		return "{" + strings.Join(elems, ", ") + "}"
+	}
+	return val.String()
+}
+
+// quote returns s as a string literal, using the escapes the lexer reads.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r <= 0xffff && !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// isKey reports whether val may be used as a MapVal key.
+func isKey(val Value) bool {
+	switch val.(type) {
+	case NumVal, FloatVal, StrVal, BoolVal, SymVal:
+		return true
+	}
+	return false
+}
+
+// BuiltInFuncVal is a function implemented in Go. Arguments are checked
+// against params before f is called, so f may assume they have the
+// declared types. The last optional params may be left out. If variadic is
+// set, the last param may be repeated any number of times, including zero.
+type BuiltInFuncVal struct {
+	name     string
+	params   []ValType
+	optional int
+	variadic bool
+	f        func(args ...Value) (Value, error)
+}
+
+// NewBuiltin returns a function implemented by f. Calls are checked
+// against params, which gives the type of each parameter (or AnyT), so f
+// may assume its arguments have the declared types. args may be part of
+// the VM's stack, so f must not keep it after returning.
+func NewBuiltin(name string, params []ValType, f func(args ...Value) (Value, error)) BuiltInFuncVal {
+	return BuiltInFuncVal{name: name, params: params, f: f}
+}
+
+func (BuiltInFuncVal) Type() ValType {
+	return FuncT
+}
+
+func (f BuiltInFuncVal) Value() func(...Value) (Value, error) {
+	return f.f
+}
+
+func (f BuiltInFuncVal) String() string {
+	var params []string
+	for i, param := range f.params {
+		if i == len(f.params)-f.optional {
+			params = append(params, "&optional")
+		}
+		params = append(params, param.String())
+	}
+	if f.variadic {
+		params[len(params)-1] += "..."
+	}
+	return fmt.Sprintf("builtin %s[%s]", f.name, strings.Join(params, " "))
+}
+
+func (f BuiltInFuncVal) check(args []Value) error {
+	min, max := len(f.params)-f.optional, len(f.params)
+	if f.variadic {
+		min--
+	}
+	switch {
+	case f.variadic && len(args) < min:
+		return newError(ArityErr, "bad arity calling %s: got %d, expected at least %d", f.name, len(args), min)
+	case f.variadic:
+	case min == max && len(args) != min:
+		return newError(ArityErr, "bad arity calling %s: got %d, expected %d", f.name, len(args), min)
+	case len(args) < min || len(args) > max:
+		return newError(ArityErr, "bad arity calling %s: got %d, expected %d to %d", f.name, len(args), min, max)
+	}
+	for i, arg := range args {
+		typ := f.params[len(f.params)-1]
+		if i < len(f.params) {
+			typ = f.params[i]
+		}
+		if typ != AnyT && arg.Type() != typ {
+			return newError(TypeErr, "%s: argument %d must be %s, got %s", f.name, i+1, typ, arg.Type())
+		}
+	}
+	return nil
+}
+
+type lambdaVal struct {
+	name   string
+	env    *frame
+	params *paramList
+	locals []string
+	body   expr
+}
+
+func (lambdaVal) Type() ValType {
+	return FuncT
+}
+
+func (l lambdaVal) Value() lambdaVal {
+	return l
+}
+
+// Name returns the name given by defun, or "fn" for anonymous lambdas.
+func (l lambdaVal) Name() string {
+	if l.name == "" {
+		return "fn"
+	}
+	return l.name
+}
+
+func (l lambdaVal) String() string {
+	return fmt.Sprintf("%s(%s)", l.Name(), l.params)
+}
+
+type BoolVal bool
+
+func (BoolVal) Type() ValType {
+	return BoolT
+}
+
+func (b BoolVal) Value() bool {
+	return bool(b)
+}
+
+func (b BoolVal) String() string {
+	return fmt.Sprintf("%t", b)
+}
+
+// appendLists concatenates the elements of the lists spliced into a
+// quasiquote template.
+func appendLists(vals []Value) (ListVal, error) {
+	list := ListVal{}
+	for _, val := range vals {
+		elems, ok := val.(ListVal)
+		if !ok {
+			return nil, newError(TypeErr, "unquote-splicing: expected list, got %s", val.Type())
+		}
+		list = append(list, elems...)
+	}
+	return list, nil
+}
+
+// isTrue reports whether val counts as true in a condition. Only false
+// and null are false: every other value, including 0, "" and the empty
+// list, is true. if, cond, when, unless, and, or and not all use this
+// rule.
+func isTrue(val Value) bool {
+	switch val := val.(type) {
+	case BoolVal:
+		return bool(val)
+	case NullVal:
+		return false
+	}
+	return true
+}
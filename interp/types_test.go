@@ -0,0 +1,51 @@
+package interp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRepr(t *testing.T) {
+	for _, tc := range []struct {
+		val  Value
+		want string
+	}{
+		{StrVal("str"), `"str"`},
+		{Intern("str"), `str`},
+		{StrVal("a \"b\"\\\n\t\r\x01é"), `"a \"b\"\\\n\t\r\u0001é"`},
+		{ListVal{StrVal("a"), Intern("a"), NumVal(1)}, `["a", a, 1]`},
+		{MapVal{StrVal("k"): StrVal("v")}, `{"k": "v"}`},
+	} {
+		if got := Repr(tc.val); got != tc.want {
+			t.Errorf("Repr(%s): got %s, want %s", tc.val, got, tc.want)
+		}
+	}
+}
+
+func TestReprReadsBack(t *testing.T) {
+	src := "a \"b\"\\\n\t\r\x01é"
+	val, err := New(Options{}).EvalString(Repr(StrVal(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != StrVal(src) {
+		t.Errorf("got %q, want %q", val, src)
+	}
+}
+
+func TestBuiltinArity(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		evalTests{
+			{"substring", "builtin substring[str num &optional num]"},
+			{"concat", "builtin concat[str...]"},
+			{"first", "builtin first[list]"},
+			{`(substring "abcd" 1)`, "bcd"},
+			{`(substring "abcd" 1 3)`, "bc"},
+			{`(try (substring "abcd") (catch :arity e (error-message e)))`, "bad arity calling substring: got 1, expected 2 to 3"},
+			{`(try (substring "abcd" 1 2 3) (catch :arity e (error-message e)))`, "bad arity calling substring: got 4, expected 2 to 3"},
+			{`(try (substring "abcd" 1 "2") (catch :type e (error-message e)))`, "substring: argument 3 must be num, got str"},
+			{`(try (first) (catch :arity e (error-message e)))`, "bad arity calling first: got 0, expected 1"},
+			{`(try (error) (catch :arity e (error-message e)))`, "bad arity calling error: got 0, expected at least 1"},
+		}.run(t, in)
+	})
+}
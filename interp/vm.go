@@ -0,0 +1,428 @@
+package interp
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// closureVal is a lambda compiled for the VM.
+type closureVal struct {
+	proto *prototype
+	env   *frame
+}
+
+func (closureVal) Type() ValType {
+	return FuncT
+}
+
+func (c closureVal) String() string {
+	return c.proto.String()
+}
+
+func (c closureVal) Name() string {
+	return c.proto.name()
+}
+
+type vmFrame struct {
+	proto *prototype
+	env   *frame
+	ip    int  // next instruction
+	pc    int  // current instruction
+	base  int  // stack height when the frame was entered
+	call  bool // false for the frame of a top-level expression
+	site  Span
+}
+
+func (f *vmFrame) u8() int {
+	n := int(f.proto.Code[f.ip])
+	f.ip++
+	return n
+}
+
+func (f *vmFrame) u16() int {
+	n := int(binary.BigEndian.Uint16(f.proto.Code[f.ip:]))
+	f.ip += 2
+	return n
+}
+
+// handler records the state to restore when an error is caught by the
+// catch and finally clauses of a try.
+type handler struct {
+	frame int // index of the frame running the try
+	stack int // stack height when the try started
+	env   *frame
+	pc    int
+}
+
+// machine is a stack machine that runs code produced by the compiler.
+// Calls do not recurse on the Go stack, and tail calls reuse the caller's
+// frame.
+type machine struct {
+	globals  map[string]Value
+	stack    []Value
+	frames   []vmFrame
+	handlers []handler
+	outer    int      // number of frames that belong to enclosing calls of exec
+	free     []*frame // frames of returned calls, to be reused
+}
+
+func newMachine() machine {
+	return machine{globals: make(map[string]Value)}
+}
+
+// Eval compiles and runs a resolved top-level expression.
+func (vm *machine) Eval(e expr) (Value, error) {
+	proto, err := compile(e)
+	if err != nil {
+		return nil, err
+	}
+	return vm.runProto(proto)
+}
+
+// runProto runs a prototype compiled from a top-level expression.
+func (vm *machine) runProto(proto *prototype) (Value, error) {
+	return vm.exec(vmFrame{proto: proto, base: len(vm.stack)})
+}
+
+// Call calls fn with args. It may be used while a program is running, for
+// example by a builtin that takes a function.
+func (vm *machine) Call(fn Value, args ...Value) (Value, error) {
+	c := newCompiler(&prototype{Top: true})
+	if len(args) > math.MaxUint16 {
+		return nil, newError(ArityErr, "too many arguments")
+	}
+	c.emit(opCall, len(args))
+	c.emit(opReturn)
+	base := len(vm.stack)
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	return vm.exec(vmFrame{proto: c.proto, base: base})
+}
+
+// exec runs f until it returns. Calls may be nested: when a builtin calls
+// back into the VM, the frames of the outer call stay below f.
+func (vm *machine) exec(f vmFrame) (Value, error) {
+	outer := vm.outer
+	defer func() {
+		vm.outer = outer
+	}()
+	vm.outer = len(vm.frames)
+	vm.frames = append(vm.frames, f)
+	for {
+		val, err := vm.run()
+		if err == nil {
+			return val, nil
+		}
+		rerr := vm.locate(err)
+		if vm.catch(rerr) {
+			continue
+		}
+		vm.frames = vm.frames[:vm.outer]
+		vm.stack = vm.stack[:f.base]
+		return nil, rerr
+	}
+}
+
+// catch unwinds to the innermost try of this call of exec, and resumes
+// at its handler with err pushed. It reports false if there is none, in
+// which case the error is returned to the caller of exec.
+func (vm *machine) catch(err *RuntimeError) bool {
+	n := len(vm.handlers)
+	if n == 0 || vm.handlers[n-1].frame < vm.outer {
+		return false
+	}
+	h := vm.handlers[n-1]
+	vm.handlers = vm.handlers[:n-1]
+	vm.frames = vm.frames[:h.frame+1]
+	f := &vm.frames[h.frame]
+	f.env, f.ip = h.env, h.pc
+	vm.stack = vm.stack[:h.stack]
+	vm.push(ErrorVal{err})
+	return true
+}
+
+// setGlobal defines a global variable.
+func (vm *machine) setGlobal(name string, val Value) {
+	vm.globals[name] = val
+}
+
+func (vm *machine) push(val Value) {
+	vm.stack = append(vm.stack, val)
+}
+
+func (vm *machine) pop() Value {
+	end := len(vm.stack) - 1
+	val := vm.stack[end]
+	vm.stack = vm.stack[:end]
+	return val
+}
+
+// locate positions err at the current instruction of the innermost frame.
+func (vm *machine) locate(err error) *RuntimeError {
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		rerr = &RuntimeError{Kind: EvalErr, Err: err}
+	}
+	if !rerr.located() {
+		f := vm.frames[len(vm.frames)-1]
+		rerr.Loc = f.proto.locAt(f.pc)
+		for i := len(vm.frames) - 1; i >= 0; i-- {
+			if f := vm.frames[i]; f.call {
+				rerr.Stack = append(rerr.Stack, CallFrame{f.proto.name(), f.site.Start})
+			}
+		}
+	}
+	return rerr
+}
+
+// frame returns a frame for a call with slots named by names, reusing one
+// released by a call that has returned if there is one.
+func (vm *machine) frame(names []string, up *frame) *frame {
+	n := len(vm.free)
+	if n == 0 {
+		return newFrame(names, up)
+	}
+	env := vm.free[n-1]
+	vm.free = vm.free[:n-1]
+	if cap(env.slots) < len(names) {
+		env.slots = make([]Value, len(names))
+	}
+	env.slots, env.names, env.up = env.slots[:len(names)], names, up
+	return env
+}
+
+// release makes the frame of a call that is returning available for reuse,
+// unless the call made closures that may still refer to it.
+func (vm *machine) release(f *vmFrame) {
+	if !f.call || f.proto.Captures {
+		return
+	}
+	for i := range f.env.slots {
+		f.env.slots[i] = nil
+	}
+	vm.free = append(vm.free, f.env)
+}
+
+// call calls the function below the top argc values on the stack. Builtins
+// are run immediately; for closures a new frame is pushed, or if tail is
+// set, the current frame is replaced.
+func (vm *machine) call(argc int, tail bool) (bool, error) {
+	f := &vm.frames[len(vm.frames)-1]
+	base := len(vm.stack) - argc - 1
+	args := vm.stack[base+1 : len(vm.stack) : len(vm.stack)]
+	switch fn := vm.stack[base].(type) {
+	case NullVal:
+		return false, newError(TypeErr, "can't call null as function")
+	case BuiltInFuncVal:
+		if err := fn.check(args); err != nil {
+			return false, err
+		}
+		val, err := fn.f(args...)
+		if err != nil {
+			return false, err
+		}
+		vm.stack = vm.stack[:base]
+		vm.push(val)
+		if tail {
+			return vm.ret(), nil
+		}
+		return false, nil
+	case closureVal:
+		env := vm.frame(fn.proto.Locals, fn.env)
+		if fn.proto.Arity == len(args) {
+			copy(env.slots, args)
+		} else if err := fn.proto.Params.bind(fn.Name(), args, env.slots); err != nil {
+			return false, err
+		}
+		next := vmFrame{proto: fn.proto, env: env, base: base, call: true, site: f.proto.locAt(f.pc)}
+		if tail {
+			next.base = f.base
+			vm.stack = vm.stack[:f.base]
+			vm.release(f)
+			*f = next
+		} else {
+			vm.stack = vm.stack[:base]
+			vm.frames = append(vm.frames, next)
+		}
+		return false, nil
+	default:
+		return false, newError(TypeErr, "can't call %s as function", fn.Type())
+	}
+}
+
+// ret pops the current frame and pushes its result for the caller. It
+// reports whether the frame passed to exec returned.
+func (vm *machine) ret() bool {
+	val := vm.pop()
+	f := vm.frames[len(vm.frames)-1]
+	vm.release(&f)
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.stack = vm.stack[:f.base]
+	vm.push(val)
+	return len(vm.frames) == vm.outer
+}
+
+func (vm *machine) run() (Value, error) {
+	for {
+		f := &vm.frames[len(vm.frames)-1]
+		f.pc = f.ip
+		op := opcode(f.u8())
+
+		switch op {
+		case opConst:
+			vm.push(f.proto.Consts[f.u16()])
+		case opNull:
+			vm.push(Null)
+		case opPop:
+			vm.pop()
+		case opDup:
+			vm.push(vm.stack[len(vm.stack)-1])
+		case opSwap:
+			n := len(vm.stack)
+			vm.stack[n-2], vm.stack[n-1] = vm.stack[n-1], vm.stack[n-2]
+		case opLoadLocal:
+			val, err := f.env.at(f.u8()).get(f.u16())
+			if err != nil {
+				return nil, err
+			}
+			vm.push(val)
+		case opStoreLocal:
+			e := f.env.at(f.u8())
+			e.slots[f.u16()] = vm.pop()
+		case opSetLocal:
+			e := f.env.at(f.u8())
+			if err := e.set(f.u16(), vm.pop()); err != nil {
+				return nil, err
+			}
+		case opLoadGlobal:
+			name := f.proto.Consts[f.u16()].String()
+			val, ok := vm.globals[name]
+			if !ok {
+				return nil, newError(UndefinedErr, "undefined: %s", name)
+			}
+			vm.push(val)
+		case opDefGlobal:
+			name := f.proto.Consts[f.u16()].String()
+			vm.globals[name] = vm.pop()
+		case opSetGlobal:
+			name := f.proto.Consts[f.u16()].String()
+			if _, ok := vm.globals[name]; !ok {
+				return nil, newError(UndefinedErr, "undefined: %s", name)
+			}
+			vm.globals[name] = vm.pop()
+		case opLoadBuiltin:
+			vm.push(builtinTable[f.u16()])
+		case opJump:
+			f.ip = f.u16()
+		case opJumpIfFalse:
+			target := f.u16()
+			if !isTrue(vm.pop()) {
+				f.ip = target
+			}
+		case opJumpIfFalseOrPop, opJumpIfTrueOrPop:
+			target := f.u16()
+			if isTrue(vm.stack[len(vm.stack)-1]) == (op == opJumpIfTrueOrPop) {
+				f.ip = target
+			} else {
+				vm.pop()
+			}
+		case opJumpIfBound:
+			target, slot := f.u16(), f.u16()
+			if f.env.slots[slot] != nil {
+				f.ip = target
+			}
+		case opMember:
+			key := vm.stack[len(vm.stack)-1]
+			found := false
+			for _, val := range f.proto.Consts[f.u16()].(ListVal) {
+				if eqv(key, val) {
+					found = true
+					break
+				}
+			}
+			vm.push(BoolVal(found))
+		case opList:
+			n := f.u16()
+			list := append(ListVal{}, vm.stack[len(vm.stack)-n:]...)
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(list)
+		case opAppend:
+			n := f.u16()
+			list, err := appendLists(vm.stack[len(vm.stack)-n:])
+			if err != nil {
+				return nil, err
+			}
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(list)
+		case opCall, opTailCall:
+			done, err := vm.call(f.u16(), op == opTailCall)
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				return vm.pop(), nil
+			}
+		case opReturn:
+			if vm.ret() {
+				return vm.pop(), nil
+			}
+		case opClosure:
+			vm.push(closureVal{f.proto.Protos[f.u16()], f.env})
+		case opEnter:
+			f.env = newFrame(f.proto.Envs[f.u16()], f.env)
+		case opLeave:
+			f.env = f.env.up
+		case opDestructure:
+			if err := f.proto.Patterns[f.u16()].bind(vm.pop(), f.env.slots); err != nil {
+				return nil, err
+			}
+		case opMatchConst:
+			target, val := f.u16(), f.proto.Consts[f.u16()]
+			if !eqv(val, vm.pop()) {
+				f.ip = target
+			}
+		case opMatchList:
+			// The parts are pushed in reverse, so that the first element
+			// is matched first and the rest of the list last.
+			target, n, rest := f.u16(), f.u16(), f.u8() != 0
+			elems, tail, ok := splitList(vm.pop(), n, rest)
+			if !ok {
+				f.ip = target
+				break
+			}
+			if rest {
+				vm.push(tail)
+			}
+			for i := n - 1; i >= 0; i-- {
+				vm.push(elems[i])
+			}
+		case opMatchMap:
+			target, keys := f.u16(), f.proto.Consts[f.u16()].(ListVal)
+			vals, ok := mapValues(vm.pop(), keys)
+			if !ok {
+				f.ip = target
+				break
+			}
+			for i := len(vals) - 1; i >= 0; i-- {
+				vm.push(vals[i])
+			}
+		case opTry:
+			vm.handlers = append(vm.handlers, handler{len(vm.frames) - 1, len(vm.stack), f.env, f.u16()})
+		case opEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case opThrow:
+			return nil, vm.pop().(ErrorVal).err
+		case opJumpUnlessKind:
+			target, kind := f.u16(), ErrorKind(f.u8())
+			if vm.stack[len(vm.stack)-1].(ErrorVal).Kind() != kind {
+				f.ip = target
+			}
+		case opNoMatch:
+			return nil, newError(MatchErr, "no match for %s", vm.pop())
+		default:
+			return nil, newError(EvalErr, "bad opcode: %s", op)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package interp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVMFrameReuse(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, in *Interp, _ *bytes.Buffer) {
+		evalTests{
+			{"(defun add (a b) (+ a b))", "null"},
+			{"(defun capture (n) (fn () n))", "null"},
+			// The frames of add are reused, but not those of capture, whose
+			// closures keep them.
+			{"(def thunks (list (capture (add 1 2)) (capture (add 3 4))))", "null"},
+			{"(add (add 1 2) (add 3 4))", "10"},
+			{"(list ((first thunks)) ((first (rest thunks))))", "[3, 7]"},
+			// A tail call from a frame that is reused.
+			{"(defun count (n acc) (if (= n 0) acc (count (- n 1) (add acc 1))))", "null"},
+			{"(count 10000 0)", "10000"},
+			// Calls with the wrong number of arguments still fail.
+			{"(try (add 1) (catch :arity e (error-message e)))", "bad arity calling add: got 1, expected 2"},
+			{"(try (add 1 2 3) (catch :arity e (error-message e)))", "bad arity calling add: got 3, expected 2"},
+			{"(add 5 6)", "11"},
+		}.run(t, in)
+	})
+}
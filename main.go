@@ -1,42 +1,118 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+
+	"github.com/dhconnelly/yalig/interp"
+)
+
+var (
+	engineFlag = flag.String("engine", "tree", "evaluation engine: tree, vm, or both to run under each and compare the output")
+	disasmFlag = flag.Bool("disasm", false, "print the bytecode of each top-level expression")
+	replFlag   = flag.Bool("i", false, "start the REPL even if stdin is not a terminal")
 )
 
+var engines = map[string]interp.Engine{
+	"tree": interp.TreeEngine,
+	"vm":   interp.VMEngine,
+}
+
+func formatError(err error) string {
+	if rerr, ok := err.(*interp.RuntimeError); ok {
+		return rerr.Traceback()
+	}
+	return err.Error()
+}
+
+// check runs the program in the named file under both engines and
+// reports whether they printed the same output and failed the same way.
+func check(name string) bool {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var outputs [2]string
+	for i, engine := range []interp.Engine{interp.TreeEngine, interp.VMEngine} {
+		var out bytes.Buffer
+		in := interp.New(interp.Options{Engine: engine, Stdout: &out})
+		if _, err := in.EvalReader(name, bytes.NewReader(src)); err != nil {
+			fmt.Fprintln(&out, formatError(err))
+		}
+		outputs[i] = out.String()
+	}
+	if outputs[0] != outputs[1] {
+		fmt.Printf("FAIL %s\n-- tree:\n%s-- vm:\n%s", name, outputs[0], outputs[1])
+		return false
+	}
+	fmt.Printf("ok   %s\n", name)
+	return true
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: yalig [flags] [file]\n       yalig -engine=both file...\n\nWith no file, yalig starts a REPL, or runs stdin if it is not a terminal.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *engineFlag == "both" {
+		if flag.NArg() == 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		ok := true
+		for _, name := range flag.Args() {
+			ok = check(name) && ok
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+	engine, ok := engines[*engineFlag]
+	if !ok {
+		log.Fatalf("unknown engine: %s", *engineFlag)
+	}
+
+	opts := interp.Options{Engine: engine}
+	if *disasmFlag {
+		opts.Disasm = os.Stdout
+	}
+
 	fmt.Println("== yalig!")
-	var b *bufio.Reader
-	switch len(os.Args) {
+	var r io.Reader
+	name := "<stdin>"
+	switch flag.NArg() {
+	case 0:
+		if *replFlag || isTerminal(os.Stdin) {
+			opts.AllowUndefined = true
+			repl(interp.New(opts), os.Stdin, os.Stdout)
+			return
+		}
+		r = os.Stdin
 	case 1:
-		b = bufio.NewReader(os.Stdin)
-	case 2:
-		in, err := os.Open(os.Args[1])
+		name = flag.Arg(0)
+		in, err := os.Open(name)
 		if err != nil {
 			log.Fatal(err)
 		}
-		b = bufio.NewReader(in)
+		defer in.Close()
+		r = in
 	default:
-		log.Fatal("Usage: yalig [file]")
-	}
-	p := NewParser(NewLexer(b))
-	e := NewEvaluator()
-	for {
-		// Read
-		expr, err := p.Parse()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			log.Fatal(err)
-		}
-		// Eval
-		_, err = e.Eval(expr)
-		if err != nil {
-			log.Fatal(err)
-		}
+		flag.Usage()
+		os.Exit(2)
+	}
+	if _, err := interp.New(opts).EvalReader(name, r); err != nil {
+		log.Fatal(formatError(err))
 	}
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dhconnelly/yalig/interp"
+)
+
+// historyPath returns the file in which REPL input is saved between
+// sessions: $YALIG_HISTORY, or ~/.yalig_history.
+func historyPath() string {
+	if path := os.Getenv("YALIG_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".yalig_history")
+}
+
+// history is the list of entries typed into the REPL, including those
+// loaded from previous sessions.
+type history struct {
+	entries []string
+	file    *os.File
+}
+
+func openHistory(path string) *history {
+	h := &history{}
+	if path == "" {
+		return h
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				h.entries = append(h.entries, line)
+			}
+		}
+	}
+	if f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+		h.file = f
+	}
+	return h
+}
+
+// add records an entry, joining multi-line input onto one line.
+func (h *history) add(entry string) {
+	entry = strings.Join(strings.Fields(entry), " ")
+	if entry == "" {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if h.file != nil {
+		fmt.Fprintln(h.file, entry)
+	}
+}
+
+// recall returns the entry that cmd refers to: !n for the nth entry, as
+// numbered by :history, or !! for the last. It reports false if cmd is not
+// a history reference.
+func (h *history) recall(cmd string) (string, bool, error) {
+	if len(cmd) < 2 || cmd[0] != '!' {
+		return "", false, nil
+	}
+	n := len(h.entries)
+	if cmd != "!!" {
+		i, err := strconv.Atoi(cmd[1:])
+		if err != nil {
+			return "", false, nil
+		}
+		n = i
+	}
+	if n < 1 || n > len(h.entries) {
+		return "", true, fmt.Errorf("%s: no such history entry", cmd)
+	}
+	return h.entries[n-1], true, nil
+}
+
+func (h *history) close() {
+	if h.file != nil {
+		h.file.Close()
+	}
+}
+
+// incomplete reports whether err means that the input ended in the middle
+// of an expression, so that more lines may complete it.
+func incomplete(err error) bool {
+	var serr *interp.SyntaxError
+	return errors.As(err, &serr) && errors.Is(serr, io.EOF)
+}
+
+// repl reads expressions from r and prints the value of each one. Input
+// is read until it forms complete expressions, and errors are reported
+// without losing the definitions made so far.
+func repl(in *interp.Interp, r io.Reader, out io.Writer) {
+	h := openHistory(historyPath())
+	defer h.close()
+	lines := bufio.NewScanner(r)
+	var input strings.Builder
+	for {
+		if input.Len() == 0 {
+			fmt.Fprint(out, "> ")
+		} else {
+			fmt.Fprint(out, "... ")
+		}
+		if !lines.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := lines.Text()
+		if input.Len() == 0 {
+			cmd := strings.TrimSpace(line)
+			if cmd == ":history" {
+				for i, entry := range h.entries {
+					fmt.Fprintf(out, "%5d  %s\n", i+1, entry)
+				}
+				continue
+			}
+			entry, ok, err := h.recall(cmd)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			} else if ok {
+				fmt.Fprintln(out, entry)
+				line = entry
+			}
+		}
+		input.WriteString(line)
+		input.WriteString("\n")
+
+		err := in.EvalEach("<repl>", strings.NewReader(input.String()), func(val interp.Value) {
+			if val != interp.Null {
+				fmt.Fprintln(out, interp.Repr(val))
+			}
+		})
+		if incomplete(err) {
+			continue
+		}
+		h.add(input.String())
+		input.Reset()
+		if err != nil {
+			fmt.Fprintln(out, formatError(err))
+		}
+	}
+}
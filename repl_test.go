@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhconnelly/yalig/interp"
+)
+
+func TestREPL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yalig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("YALIG_HISTORY", filepath.Join(dir, "history"))
+	defer os.Unsetenv("YALIG_HISTORY")
+
+	input := strings.Join([]string{
+		`1 2 3`,
+		`(defun sq (x)`,
+		`  (* x x))`,
+		`(sq 4) "s" null`,
+		`(first '())`,
+		`(sq 5)`,
+		`!2`,
+		`!!`,
+		`!9`,
+	}, "\n") + "\n"
+	var out strings.Builder
+	in := interp.New(interp.Options{Stdout: &out, AllowUndefined: true})
+	repl(in, strings.NewReader(input), &out)
+
+	want := strings.Join([]string{
+		`> 1`,
+		`2`,
+		`3`,
+		`> ... > 16`,
+		`"s"`,
+		`> <repl>:1:1: type error: first: empty list`,
+		`> 25`,
+		`> (defun sq (x) (* x x))`,
+		`> (defun sq (x) (* x x))`,
+		`> !9: no such history entry`,
+		`> `,
+		``,
+	}, "\n")
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	history, err := ioutil.ReadFile(os.Getenv("YALIG_HISTORY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHistory := strings.Join([]string{
+		`1 2 3`,
+		`(defun sq (x) (* x x))`,
+		`(sq 4) "s" null`,
+		`(first '())`,
+		`(sq 5)`,
+		`(defun sq (x) (* x x))`,
+		`(defun sq (x) (* x x))`,
+	}, "\n") + "\n"
+	if got := string(history); got != wantHistory {
+		t.Errorf("got history:\n%s\nwant:\n%s", got, wantHistory)
+	}
+}